@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package zk
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"strings"
+
+	"github.com/facebookincubator/zk/internal/data"
+)
+
+// Perm is a bitmask of the permissions granted by an ACL entry.
+type Perm int32
+
+// These constants represent the permissions which can be granted on a znode.
+// ref: https://zookeeper.apache.org/doc/current/zookeeperProgrammers.html#sc_ACLPermissions
+const (
+	PermRead Perm = 1 << iota
+	PermWrite
+	PermCreate
+	PermDelete
+	PermAdmin
+	PermAll = PermRead | PermWrite | PermCreate | PermDelete | PermAdmin
+)
+
+var permNames = []struct {
+	perm Perm
+	name string
+}{
+	{PermRead, "r"},
+	{PermWrite, "w"},
+	{PermCreate, "c"},
+	{PermDelete, "d"},
+	{PermAdmin, "a"},
+}
+
+// String returns the permissions in the format used by the Zookeeper CLI, for example "cdrwa".
+func (p Perm) String() string {
+	var sb strings.Builder
+	for _, entry := range permNames {
+		if p&entry.perm != 0 {
+			sb.WriteString(entry.name)
+		}
+	}
+
+	return sb.String()
+}
+
+// Id identifies the entity an ACL entry applies to, for example "world:anyone" or "ip:127.0.0.1".
+type Id struct {
+	Scheme string
+	ID     string
+}
+
+// ClientInfo is an identity the session is authenticated as, as returned by WhoAmI.
+type ClientInfo struct {
+	AuthScheme string
+	User       string
+}
+
+// ACL is an access control list entry which grants a set of permissions to an Id.
+type ACL struct {
+	Perms Perm
+	ID    Id
+}
+
+var (
+	// AnyoneIdUnsafe represents anyone, including unauthenticated clients.
+	AnyoneIdUnsafe = Id{Scheme: "world", ID: "anyone"}
+	// AuthIds is substituted by the server with the ids the client has authenticated as.
+	AuthIds = Id{Scheme: "auth", ID: ""}
+)
+
+// Predefined ACLs matching the ones provided by the Zookeeper Java client.
+// ref: https://zookeeper.apache.org/doc/current/apidocs/zookeeper-server/org/apache/zookeeper/ZooDefs.Ids.html
+var (
+	// OpenACLUnsafe is a completely open ACL, which grants all permissions to anyone.
+	OpenACLUnsafe = []ACL{{Perms: PermAll, ID: AnyoneIdUnsafe}}
+	// CreatorAllACL grants all permissions to the creator of the znode.
+	// The client needs to be authenticated, for example using AddAuth, for this ACL to be accepted by the server.
+	CreatorAllACL = []ACL{{Perms: PermAll, ID: AuthIds}}
+	// ReadACLUnsafe grants read permissions to anyone.
+	ReadACLUnsafe = []ACL{{Perms: PermRead, ID: AnyoneIdUnsafe}}
+)
+
+// WorldACL returns an ACL which grants the given permissions to anyone.
+func WorldACL(perms Perm) []ACL {
+	return []ACL{{Perms: perms, ID: AnyoneIdUnsafe}}
+}
+
+// DigestACL returns an ACL which grants the given permissions to the user authenticated with the given password.
+func DigestACL(perms Perm, user, password string) []ACL {
+	return []ACL{{Perms: perms, ID: DigestId(user, password)}}
+}
+
+// DigestId computes the Id used by the digest scheme for the given credentials, which is
+// the user name followed by the base64-encoded SHA1 hash of "user:password".
+// Clients authenticate as this Id by calling AddAuth with the "digest" scheme and "user:password" credentials.
+func DigestId(user, password string) Id {
+	hash := sha1.Sum([]byte(user + ":" + password))
+
+	return Id{Scheme: "digest", ID: user + ":" + base64.StdEncoding.EncodeToString(hash[:])}
+}
+
+// toDataACL converts ACL entries to the representation used on the wire.
+func toDataACL(acl []ACL) []data.ACL {
+	if acl == nil {
+		return nil
+	}
+
+	converted := make([]data.ACL, len(acl))
+	for i, entry := range acl {
+		converted[i] = data.ACL{
+			Perms: int32(entry.Perms),
+			Id:    data.Id{Scheme: entry.ID.Scheme, Id: entry.ID.ID},
+		}
+	}
+
+	return converted
+}
+
+// fromDataACL converts ACL entries received on the wire.
+func fromDataACL(acl []data.ACL) []ACL {
+	if acl == nil {
+		return nil
+	}
+
+	converted := make([]ACL, len(acl))
+	for i, entry := range acl {
+		converted[i] = ACL{
+			Perms: Perm(entry.Perms),
+			ID:    Id{Scheme: entry.Id.Scheme, ID: entry.Id.Id},
+		}
+	}
+
+	return converted
+}
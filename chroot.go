@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package zk
+
+import "strings"
+
+// splitChroot splits the chroot suffix, such as "/app" in "host1:2181,host2:2181/app", from a connect string.
+func splitChroot(ensemble string) (string, string) {
+	if idx := strings.Index(ensemble, "/"); idx != -1 {
+		return ensemble[:idx], ensemble[idx:]
+	}
+
+	return ensemble, ""
+}
+
+// normalizeChroot validates the chroot, returning an empty chroot if it is the root path.
+func normalizeChroot(chroot string) (string, error) {
+	if chroot == "" || chroot == "/" {
+		return "", nil
+	}
+	if !strings.HasPrefix(chroot, "/") || strings.HasSuffix(chroot, "/") || strings.Contains(chroot, "//") {
+		return "", invalidArgsError("invalid chroot %q", chroot)
+	}
+
+	return chroot, nil
+}
+
+// serverPath returns the path of the znode on the server, which is the given path prefixed with the chroot.
+func (c *Conn) serverPath(path string) string {
+	if c.chroot == "" {
+		return path
+	}
+	if path == "/" {
+		return c.chroot
+	}
+
+	return c.chroot + path
+}
+
+// clientPath strips the chroot from a path returned by the server. Paths outside of the chroot are returned unchanged.
+func (c *Conn) clientPath(path string) string {
+	if c.chroot == "" || !c.inChroot(path) {
+		return path
+	}
+	if path == c.chroot {
+		return "/"
+	}
+
+	return path[len(c.chroot):]
+}
+
+// inChroot returns whether the server path lies within the chroot.
+func (c *Conn) inChroot(path string) bool {
+	return c.chroot == "" || path == c.chroot || strings.HasPrefix(path, c.chroot+"/")
+}
+
+// chrootPath returns the chroot of the client, set either through the Chroot field or the ensemble connect string.
+func (client *Client) chrootPath() string {
+	if client.Chroot != "" {
+		return client.Chroot
+	}
+	if !isTCPNetwork(client.Network) {
+		return "" // addresses of other networks, such as unix socket paths, may contain slashes
+	}
+	_, chroot := splitChroot(client.Ensemble)
+
+	return chroot
+}
@@ -10,15 +10,21 @@ package zk
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
+	"sync"
 	"time"
 )
 
 // ErrMaxRetries is used to differentiate retryable from non-retryable errors in the client.
 var ErrMaxRetries = errors.New("connection failed after max retries")
 
+// ErrTTLDisabled is returned when creating a TTL node on a server which does not have extended types enabled.
+// TTL nodes can be enabled on the server by setting the zookeeper.extendedTypesEnabled system property.
+var ErrTTLDisabled = errors.New("TTL nodes are disabled on the server")
+
 // Client represents a Zookeeper client abstraction with additional configuration parameters.
 type Client struct {
 	// Dialer is a function to be used to establish a connection to a single host.
@@ -27,9 +33,56 @@ type Client struct {
 
 	MaxRetries int
 	Network    string
-	Ensemble   string
+	// Ensemble is a comma-separated list of the ensemble's servers, such as "host1:2181,host2:2181,host3:2181".
+	// The client connects to the servers in random order, moving on to the next server when a connection fails.
+	// It can be followed by a chroot suffix, such as "host1:2181,host2:2181/app", see Chroot.
+	// For networks other than TCP, such as "unix", the ensemble is passed to the Dialer as a single address.
+	Ensemble string
+	// Chroot confines the client to the subtree at the given path, taking precedence over a chroot suffix in Ensemble.
+	// All paths sent by the client are interpreted relative to the chroot, and the chroot is stripped from all paths
+	// returned by the server, such as the paths of created znodes and of watch events.
+	// Quotas cannot be managed through a chrooted client, since they are stored outside of the chroot.
+	Chroot string
+
+	// LinearizableReads makes the client call Sync before every GetData and GetChildren call, so that reads
+	// observe all writes committed by the ensemble before the read was issued, even when connected to a lagging follower.
+	LinearizableReads bool
+
+	// SASL enables SASL authentication using the given credentials, which is performed on every new session
+	// before any other request is sent. If nil, SASL authentication is skipped.
+	SASL *SASLConfig
+
+	// TLSConfig enables TLS for connections to the ensemble, which should then point to the servers' secureClientPort.
+	// If the config does not specify a ServerName, the host of each dialed address is used instead.
+	TLSConfig *tls.Config
+
+	// ReadOnly allows the client to connect to servers which are partitioned from the ensemble's quorum.
+	// Such servers only serve reads, which may be stale, and reject writes with ErrReadOnly.
+	// While connected to a read-only server, the client probes the other servers of the ensemble
+	// in the background and reconnects once a read-write server is found.
+	ReadOnly bool
+
+	// SessionEventHandler is called whenever the session changes state, for example when a connection is lost.
+	// It is called synchronously from the goroutines handling the connection, so it should not block.
+	// The connection is already closed when the disconnected event is reported, so the handler may call Reset.
+	SessionEventHandler func(SessionEvent)
 
 	conn *Conn
+	// credentials added through AddAuth, which are replayed on every new connection
+	authInfos []authInfo
+	// the session which is resumed on every new connection, along with the watches set through the client
+	session sessionState
+	// the shuffled servers of the ensemble and the index of the server to connect to next
+	hosts    []string
+	nextHost int
+	// a read-write server found while connected to a read-only server, which is connected to next
+	probeLock     sync.Mutex
+	readWriteHost string
+}
+
+type authInfo struct {
+	scheme string
+	auth   []byte
 }
 
 // GetData uses the retryable client to call Get on a Zookeeper server.
@@ -37,6 +90,9 @@ func (client *Client) GetData(ctx context.Context, path string) ([]byte, error)
 	var err error
 	var data []byte
 	err = client.doRetry(ctx, func() error {
+		if err = client.syncIfLinearizable(path); err != nil {
+			return err
+		}
 		data, err = client.conn.GetData(path)
 		return err
 	})
@@ -44,11 +100,43 @@ func (client *Client) GetData(ctx context.Context, path string) ([]byte, error)
 	return data, err
 }
 
+// GetDataWithStat uses the retryable client to call GetDataWithStat on a Zookeeper server.
+func (client *Client) GetDataWithStat(ctx context.Context, path string) ([]byte, *Stat, error) {
+	var data []byte
+	var stat *Stat
+	var err error
+	err = client.doRetry(ctx, func() error {
+		if err = client.syncIfLinearizable(path); err != nil {
+			return err
+		}
+		data, stat, err = client.conn.GetDataWithStat(path)
+		return err
+	})
+
+	return data, stat, err
+}
+
+// Exists uses the retryable client to check whether a znode exists on a Zookeeper server.
+func (client *Client) Exists(ctx context.Context, path string) (bool, *Stat, error) {
+	var exists bool
+	var stat *Stat
+	var err error
+	err = client.doRetry(ctx, func() error {
+		exists, stat, err = client.conn.Exists(path)
+		return err
+	})
+
+	return exists, stat, err
+}
+
 // GetChildren uses the retryable client to call GetChildren on a Zookeeper server.
 func (client *Client) GetChildren(ctx context.Context, path string) ([]string, error) {
 	var children []string
 	var err error
 	err = client.doRetry(ctx, func() error {
+		if err = client.syncIfLinearizable(path); err != nil {
+			return err
+		}
 		children, err = client.conn.GetChildren(path)
 		return err
 	})
@@ -56,14 +144,311 @@ func (client *Client) GetChildren(ctx context.Context, path string) ([]string, e
 	return children, err
 }
 
+// GetChildrenWithStat uses the retryable client to call GetChildrenWithStat on a Zookeeper server.
+func (client *Client) GetChildrenWithStat(ctx context.Context, path string) ([]string, *Stat, error) {
+	var children []string
+	var stat *Stat
+	var err error
+	err = client.doRetry(ctx, func() error {
+		if err = client.syncIfLinearizable(path); err != nil {
+			return err
+		}
+		children, stat, err = client.conn.GetChildrenWithStat(path)
+		return err
+	})
+
+	return children, stat, err
+}
+
+// GetDataW uses the retryable client to call GetDataW on a Zookeeper server.
+// The watch is restored when the client reconnects, so the returned channel is not closed if the connection is lost.
+func (client *Client) GetDataW(ctx context.Context, path string) ([]byte, *Stat, <-chan Event, error) {
+	var data []byte
+	var stat *Stat
+	var events <-chan Event
+	var err error
+	err = client.doRetry(ctx, func() error {
+		if err = client.syncIfLinearizable(path); err != nil {
+			return err
+		}
+		data, stat, events, err = client.conn.GetDataW(path)
+		return err
+	})
+
+	return data, stat, events, err
+}
+
+// ExistsW uses the retryable client to call ExistsW on a Zookeeper server.
+// The watch is restored when the client reconnects, so the returned channel is not closed if the connection is lost.
+func (client *Client) ExistsW(ctx context.Context, path string) (bool, *Stat, <-chan Event, error) {
+	var exists bool
+	var stat *Stat
+	var events <-chan Event
+	var err error
+	err = client.doRetry(ctx, func() error {
+		exists, stat, events, err = client.conn.ExistsW(path)
+		return err
+	})
+
+	return exists, stat, events, err
+}
+
+// GetChildrenW uses the retryable client to call GetChildrenW on a Zookeeper server.
+// The watch is restored when the client reconnects, so the returned channel is not closed if the connection is lost.
+func (client *Client) GetChildrenW(ctx context.Context, path string) ([]string, *Stat, <-chan Event, error) {
+	var children []string
+	var stat *Stat
+	var events <-chan Event
+	var err error
+	err = client.doRetry(ctx, func() error {
+		if err = client.syncIfLinearizable(path); err != nil {
+			return err
+		}
+		children, stat, events, err = client.conn.GetChildrenW(path)
+		return err
+	})
+
+	return children, stat, events, err
+}
+
+// AddWatch uses the retryable client to call AddWatch on a Zookeeper server.
+// The watch is restored when the client reconnects, so the returned channel is not closed if the connection is lost.
+func (client *Client) AddWatch(ctx context.Context, path string, mode AddWatchMode) (<-chan Event, error) {
+	var events <-chan Event
+	var err error
+	err = client.doRetry(ctx, func() error {
+		events, err = client.conn.AddWatch(path, mode)
+		return err
+	})
+
+	return events, err
+}
+
+// RemoveWatches uses the retryable client to call RemoveWatches on a Zookeeper server.
+func (client *Client) RemoveWatches(ctx context.Context, path string, watcherType WatcherType, local bool) error {
+	return client.doRetry(ctx, func() error {
+		return client.conn.RemoveWatches(path, watcherType, local)
+	})
+}
+
+// CheckWatches uses the retryable client to call CheckWatches on a Zookeeper server.
+func (client *Client) CheckWatches(ctx context.Context, path string, watcherType WatcherType) error {
+	return client.doRetry(ctx, func() error {
+		return client.conn.CheckWatches(path, watcherType)
+	})
+}
+
+// GetEphemerals uses the retryable client to call GetEphemerals on a Zookeeper server.
+func (client *Client) GetEphemerals(ctx context.Context, prefix string) ([]string, error) {
+	var ephemerals []string
+	var err error
+	err = client.doRetry(ctx, func() error {
+		ephemerals, err = client.conn.GetEphemerals(prefix)
+		return err
+	})
+
+	return ephemerals, err
+}
+
+// GetAllChildrenNumber uses the retryable client to call GetAllChildrenNumber on a Zookeeper server.
+func (client *Client) GetAllChildrenNumber(ctx context.Context, path string) (int32, error) {
+	var number int32
+	var err error
+	err = client.doRetry(ctx, func() error {
+		number, err = client.conn.GetAllChildrenNumber(path)
+		return err
+	})
+
+	return number, err
+}
+
+// Sync uses the retryable client to call Sync on a Zookeeper server.
+func (client *Client) Sync(ctx context.Context, path string) (string, error) {
+	var syncedPath string
+	var err error
+	err = client.doRetry(ctx, func() error {
+		syncedPath, err = client.conn.Sync(path)
+		return err
+	})
+
+	return syncedPath, err
+}
+
+// Create uses the retryable client to create a znode on a Zookeeper server.
+func (client *Client) Create(ctx context.Context, path string, data []byte, flags CreateMode, acl []ACL) (string, error) {
+	var createdPath string
+	var err error
+	err = client.doRetry(ctx, func() error {
+		createdPath, err = client.conn.Create(path, data, flags, acl)
+		return err
+	})
+
+	return createdPath, err
+}
+
+// Create2 uses the retryable client to create a znode on a Zookeeper server, returning its Stat.
+func (client *Client) Create2(ctx context.Context, path string, data []byte, flags CreateMode, acl []ACL) (string, *Stat, error) {
+	var createdPath string
+	var stat *Stat
+	var err error
+	err = client.doRetry(ctx, func() error {
+		createdPath, stat, err = client.conn.Create2(path, data, flags, acl)
+		return err
+	})
+
+	return createdPath, stat, err
+}
+
+// CreateTTL uses the retryable client to create a TTL znode on a Zookeeper server.
+// If the server has TTL nodes disabled, the returned error wraps ErrTTLDisabled.
+func (client *Client) CreateTTL(ctx context.Context, path string, data []byte, flags CreateMode, acl []ACL, ttl time.Duration) (string, *Stat, error) {
+	var createdPath string
+	var stat *Stat
+	var err error
+	err = client.doRetry(ctx, func() error {
+		createdPath, stat, err = client.conn.CreateTTL(path, data, flags, acl, ttl)
+		return err
+	})
+
+	var zkError *Error
+	if errors.As(err, &zkError) && *zkError == errUnimpl {
+		return "", nil, fmt.Errorf("%w: %v", ErrTTLDisabled, err)
+	}
+
+	return createdPath, stat, err
+}
+
+// SetData uses the retryable client to call SetData on a Zookeeper server.
+func (client *Client) SetData(ctx context.Context, path string, data []byte, version int32) (*Stat, error) {
+	var stat *Stat
+	var err error
+	err = client.doRetry(ctx, func() error {
+		stat, err = client.conn.SetData(path, data, version)
+		return err
+	})
+
+	return stat, err
+}
+
+// Delete uses the retryable client to call Delete on a Zookeeper server.
+func (client *Client) Delete(ctx context.Context, path string, version int32) error {
+	return client.doRetry(ctx, func() error {
+		return client.conn.Delete(path, version)
+	})
+}
+
+// GetACL uses the retryable client to call GetACL on a Zookeeper server.
+func (client *Client) GetACL(ctx context.Context, path string) ([]ACL, *Stat, error) {
+	var acl []ACL
+	var stat *Stat
+	var err error
+	err = client.doRetry(ctx, func() error {
+		acl, stat, err = client.conn.GetACL(path)
+		return err
+	})
+
+	return acl, stat, err
+}
+
+// SetACL uses the retryable client to call SetACL on a Zookeeper server.
+func (client *Client) SetACL(ctx context.Context, path string, acl []ACL, version int32) (*Stat, error) {
+	var stat *Stat
+	var err error
+	err = client.doRetry(ctx, func() error {
+		stat, err = client.conn.SetACL(path, acl, version)
+		return err
+	})
+
+	return stat, err
+}
+
+// Multi uses the retryable client to execute a multi transaction on a Zookeeper server.
+func (client *Client) Multi(ctx context.Context, ops ...Op) ([]OpResult, error) {
+	var results []OpResult
+	var err error
+	err = client.doRetry(ctx, func() error {
+		results, err = client.conn.Multi(ops...)
+		return err
+	})
+
+	return results, err
+}
+
+// AddAuth uses the retryable client to add authentication credentials to the session.
+// The client remembers the credentials and adds them again whenever it establishes a new connection.
+func (client *Client) AddAuth(ctx context.Context, scheme string, auth []byte) error {
+	err := client.doRetry(ctx, func() error {
+		return client.conn.AddAuth(scheme, auth)
+	})
+	if err != nil {
+		return err
+	}
+
+	client.authInfos = append(client.authInfos, authInfo{scheme: scheme, auth: auth})
+
+	return nil
+}
+
+// syncIfLinearizable calls Sync on the current connection if the client is configured to use linearizable reads.
+func (client *Client) syncIfLinearizable(path string) error {
+	if !client.LinearizableReads {
+		return nil
+	}
+
+	_, err := client.conn.Sync(path)
+	return err
+}
+
+// GetConfig uses the retryable client to call GetConfig on a Zookeeper server.
+func (client *Client) GetConfig(ctx context.Context) (*EnsembleConfig, error) {
+	var config *EnsembleConfig
+	var err error
+	err = client.doRetry(ctx, func() error {
+		config, err = client.conn.GetConfig()
+		return err
+	})
+
+	return config, err
+}
+
+// Reconfig uses the retryable client to call Reconfig on a Zookeeper server.
+func (client *Client) Reconfig(ctx context.Context, joining, leaving, newMembers []string, fromConfig int64) (*EnsembleConfig, error) {
+	var config *EnsembleConfig
+	var err error
+	err = client.doRetry(ctx, func() error {
+		config, err = client.conn.Reconfig(joining, leaving, newMembers, fromConfig)
+		return err
+	})
+
+	return config, err
+}
+
+// WhoAmI uses the retryable client to call WhoAmI on a Zookeeper server.
+func (client *Client) WhoAmI(ctx context.Context) ([]ClientInfo, error) {
+	var clientInfo []ClientInfo
+	var err error
+	err = client.doRetry(ctx, func() error {
+		clientInfo, err = client.conn.WhoAmI()
+		return err
+	})
+
+	return clientInfo, err
+}
+
 // Reset closes the client's underlying connection, cancelling any RPCs currently in-flight.
-// Future RPC calls will need to re-initialize the connection.
+// Future RPC calls will need to re-initialize the connection, on which the client's watches are restored.
 func (client *Client) Reset() error {
+	if client.conn == nil {
+		return nil // the client has not connected yet
+	}
+
 	return client.conn.Close()
 }
 
 // doRetry makes attempts at connection and RPC execution according to the MaxRetries parameter.
 // If the MaxRetries value is not set, the RPC is executed only once.
+// If the session has expired, ErrSessionExpired is returned without retrying, so that callers relying on the session,
+// such as lock holders, can tell. A new session is established on the next call.
 func (client *Client) doRetry(ctx context.Context, fun func() error) error {
 	var err error
 	for i := 0; i <= client.MaxRetries; i++ {
@@ -71,6 +456,9 @@ func (client *Client) doRetry(ctx context.Context, fun func() error) error {
 			return ctx.Err() // ctx canceled, don't retry
 		}
 		if err = client.getConn(ctx); err != nil {
+			if errors.Is(err, ErrSessionExpired) {
+				return fmt.Errorf("session lost: %w", err) // expired sessions are non-retryable
+			}
 			continue
 		}
 
@@ -91,15 +479,110 @@ func (client *Client) doRetry(ctx context.Context, fun func() error) error {
 	return fmt.Errorf("%w (%d): %v", ErrMaxRetries, client.MaxRetries, err)
 }
 
+// Server returns the address of the server the client is currently connected to,
+// or an empty string if the client is not connected.
+func (client *Client) Server() string {
+	if client.conn == nil || !client.conn.isAlive() {
+		return ""
+	}
+
+	return client.conn.Server()
+}
+
+// LastZxid returns the highest zxid the client has seen across all of its connections.
+// It is sent to the server when reconnecting, which refuses the session if it is behind the client.
+func (client *Client) LastZxid() Zxid {
+	if client.conn == nil {
+		return Zxid(client.session.lastZxid)
+	}
+
+	return client.conn.LastZxid()
+}
+
+// dialEnsemble connects to the next server of the ensemble, trying each server once until a connection succeeds.
+// Since every connection attempt moves on to the next server, reconnects are made to a different server than
+// the one the previous connection failed on, if the ensemble has more than one server.
+func (client *Client) dialEnsemble(ctx context.Context) (*Conn, error) {
+	if client.hosts == nil {
+		hosts := []string{client.Ensemble}
+		if isTCPNetwork(client.Network) {
+			ensemble, _ := splitChroot(client.Ensemble)
+			var err error
+			if hosts, err = parseEnsemble(ensemble); err != nil {
+				return nil, err
+			}
+		}
+		client.hosts = hosts
+	}
+
+	if host := client.takeReadWriteHost(); host != "" {
+		for i := range client.hosts {
+			if client.hosts[i] == host {
+				client.nextHost = i
+			}
+		}
+	}
+
+	var conn *Conn
+	var err error
+	for i := 0; i < len(client.hosts); i++ {
+		address := client.hosts[client.nextHost]
+		client.nextHost = (client.nextHost + 1) % len(client.hosts)
+
+		conn, err = client.dialContext(ctx, client.Network, address, &client.session)
+		// an expired session cannot be resumed on any other server either
+		if err == nil || errors.Is(err, ErrSessionExpired) || ctx.Err() != nil {
+			break
+		}
+	}
+
+	return conn, err
+}
+
 // getConn initializes client connection or reuses it if it has already been established.
+// The session of the previous connection is resumed on the new connection, and its credentials and watches are restored.
+// If the session has expired, a new session is established on the next attempt.
 func (client *Client) getConn(ctx context.Context) error {
 	if client.conn == nil || !client.conn.isAlive() {
-		conn, err := client.DialContext(ctx, client.Network, client.Ensemble)
+		if client.session.watches == nil {
+			client.session.watches = newWatchManager()
+		}
+		if client.conn != nil {
+			client.session.lastZxid = int64(client.conn.LastZxid())
+		}
+
+		conn, err := client.dialEnsemble(ctx)
+		if errors.Is(err, ErrSessionExpired) {
+			client.session.id, client.session.passwd = 0, nil
+		}
 		if err != nil {
 			return err
 		}
+		// sessions established by read-only servers are local to them, so they are not resumed
+		// on other servers until the session has been accepted by a read-write server
+		if !conn.readOnly {
+			client.session.readWrite = true
+		}
+		if client.session.readWrite {
+			client.session.id, client.session.passwd = conn.sessionID, conn.passwd
+		}
+
+		for _, info := range client.authInfos {
+			if err = conn.AddAuth(info.scheme, info.auth); err != nil {
+				conn.Close()
+				return fmt.Errorf("could not restore authentication credentials: %w", err)
+			}
+		}
+
+		if err = conn.restoreWatches(); err != nil {
+			conn.Close()
+			return fmt.Errorf("could not restore watches: %w", err)
+		}
 
 		client.conn = conn
+		if conn.readOnly && len(client.hosts) > 1 {
+			go client.probeReadWrite(conn, client.hosts)
+		}
 	}
 
 	return nil
@@ -10,11 +10,20 @@ package zk_test
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"net"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	. "github.com/facebookincubator/zk"
+	"github.com/facebookincubator/zk/internal/data"
+	"github.com/facebookincubator/zk/internal/proto"
 	"github.com/facebookincubator/zk/testutils"
 
 	"github.com/go-zookeeper/jute/lib/go/jute"
@@ -132,3 +141,1056 @@ func TestClientErrorCodeHandling(t *testing.T) {
 		t.Fatalf("unexpected error calling GetChildren: %v", err)
 	}
 }
+
+func TestClientCreate(t *testing.T) {
+	server, err := testutils.NewServer(func(req jute.RecordReader) (Error, jute.RecordWriter) {
+		create, ok := req.(*proto.CreateRequest)
+		if !ok {
+			return testutils.DefaultHandler(req)
+		}
+		// emulate the server appending a sequence number to sequential nodes
+		if CreateMode(create.Flags) == CreateModePersistentSequential {
+			return 0, &proto.CreateResponse{Path: create.Path + "0000000001"}
+		}
+
+		return 0, &proto.CreateResponse{Path: create.Path}
+	})
+	if err != nil {
+		t.Fatalf("error creating test server: %v", err)
+	}
+	defer server.Close()
+
+	client := &Client{
+		Network:  server.Addr().Network(),
+		Ensemble: server.Addr().String(),
+	}
+	defer client.Reset()
+
+	path, err := client.Create(context.Background(), "/seq-", []byte("data"), CreateModePersistentSequential, nil)
+	if err != nil {
+		t.Fatalf("unexpected error calling Create: %v", err)
+	}
+	if expected := "/seq-0000000001"; path != expected {
+		t.Fatalf("create error: expected path %s, got %s", expected, path)
+	}
+
+	// invalid arguments are rejected client-side and should not be retried
+	var zkError *Error
+	_, err = client.Create(context.Background(), "/node", nil, CreateMode(42), nil)
+	if errors.Is(err, ErrMaxRetries) || !errors.As(err, &zkError) {
+		t.Fatalf("unexpected error calling Create with invalid create mode: %v", err)
+	}
+}
+
+func TestClientCreateTTLDisabled(t *testing.T) {
+	server, err := testutils.NewServer(func(req jute.RecordReader) (Error, jute.RecordWriter) {
+		if _, ok := req.(*proto.CreateTTLRequest); ok {
+			return -6, nil // errUnimpl is returned when extended types are disabled
+		}
+
+		return testutils.DefaultHandler(req)
+	})
+	if err != nil {
+		t.Fatalf("error creating test server: %v", err)
+	}
+	defer server.Close()
+
+	client := &Client{
+		Network:  server.Addr().Network(),
+		Ensemble: server.Addr().String(),
+	}
+	defer client.Reset()
+
+	_, _, err = client.CreateTTL(context.Background(), "/ttl", nil, CreateModePersistentWithTTL, nil, time.Minute)
+	if !errors.Is(err, ErrTTLDisabled) {
+		t.Fatalf("expected error %v, got: %v", ErrTTLDisabled, err)
+	}
+
+	// TTL create modes are not accepted by Create2
+	var zkError *Error
+	_, _, err = client.Create2(context.Background(), "/ttl", nil, CreateModePersistentWithTTL, nil)
+	if errors.Is(err, ErrMaxRetries) || !errors.As(err, &zkError) {
+		t.Fatalf("unexpected error calling Create2 with TTL create mode: %v", err)
+	}
+}
+
+func TestClientCreate2Container(t *testing.T) {
+	server, err := testutils.NewServer(func(req jute.RecordReader) (Error, jute.RecordWriter) {
+		if create, ok := req.(*proto.CreateRequest); ok {
+			return 0, &proto.Create2Response{Path: create.Path, Stat: data.Stat{Czxid: 5, Version: 0}}
+		}
+
+		return testutils.DefaultHandler(req)
+	})
+	if err != nil {
+		t.Fatalf("error creating test server: %v", err)
+	}
+	defer server.Close()
+
+	client := &Client{
+		Network:  server.Addr().Network(),
+		Ensemble: server.Addr().String(),
+	}
+	defer client.Reset()
+
+	path, stat, err := client.Create2(context.Background(), "/container", nil, CreateModeContainer, nil)
+	if err != nil {
+		t.Fatalf("unexpected error calling Create2: %v", err)
+	}
+	if path != "/container" || stat.Czxid != 5 {
+		t.Fatalf("create2 error: unexpected response path %s, stat %+v", path, stat)
+	}
+}
+
+func TestClientVersionedWrites(t *testing.T) {
+	var version int32
+	server, err := testutils.NewServer(func(req jute.RecordReader) (Error, jute.RecordWriter) {
+		// emulate the server-side version check of a single znode
+		switch r := req.(type) {
+		case *proto.SetDataRequest:
+			if r.Version != AnyVersion && r.Version != version {
+				return ErrBadVersion, nil
+			}
+			version++
+			return 0, &proto.SetDataResponse{Stat: data.Stat{Version: version}}
+		case *proto.DeleteRequest:
+			if r.Version != AnyVersion && r.Version != version {
+				return ErrBadVersion, nil
+			}
+			return 0, &testutils.EmptyResponse{}
+		}
+
+		return testutils.DefaultHandler(req)
+	})
+	if err != nil {
+		t.Fatalf("error creating test server: %v", err)
+	}
+	defer server.Close()
+
+	client := &Client{
+		MaxRetries: defaultMaxRetries,
+		Network:    server.Addr().Network(),
+		Ensemble:   server.Addr().String(),
+	}
+	defer client.Reset()
+
+	stat, err := client.SetData(context.Background(), "/node", []byte("first"), 0)
+	if err != nil {
+		t.Fatalf("unexpected error calling SetData: %v", err)
+	}
+	if stat.Version != 1 {
+		t.Fatalf("setData error: expected version 1, got %d", stat.Version)
+	}
+
+	// a stale version should be rejected without retries
+	if _, err = client.SetData(context.Background(), "/node", []byte("stale"), 0); !errors.Is(err, ErrBadVersion) {
+		t.Fatalf("expected error %v, got: %v", ErrBadVersion, err)
+	}
+	if errors.Is(err, ErrMaxRetries) {
+		t.Fatalf("version conflicts should not be retried, got: %v", err)
+	}
+
+	if _, err = client.SetData(context.Background(), "/node", []byte("any"), AnyVersion); err != nil {
+		t.Fatalf("unexpected error calling SetData with any version: %v", err)
+	}
+
+	if err = client.Delete(context.Background(), "/node", 0); !errors.Is(err, ErrBadVersion) {
+		t.Fatalf("expected error %v, got: %v", ErrBadVersion, err)
+	}
+	if err = client.Delete(context.Background(), "/node", 2); err != nil {
+		t.Fatalf("unexpected error calling Delete: %v", err)
+	}
+}
+
+func TestClientExists(t *testing.T) {
+	const sessionID = 0x1000000abcd
+	server, err := testutils.NewServer(func(req jute.RecordReader) (Error, jute.RecordWriter) {
+		if exists, ok := req.(*proto.ExistsRequest); ok {
+			if exists.Path == "/missing" {
+				return ErrNoNode, nil
+			}
+			return 0, &proto.ExistsResponse{Stat: data.Stat{Ctime: 1500, EphemeralOwner: sessionID}}
+		}
+
+		return testutils.DefaultHandler(req)
+	})
+	if err != nil {
+		t.Fatalf("error creating test server: %v", err)
+	}
+	defer server.Close()
+
+	client := &Client{
+		Network:  server.Addr().Network(),
+		Ensemble: server.Addr().String(),
+	}
+	defer client.Reset()
+
+	exists, stat, err := client.Exists(context.Background(), "/missing")
+	if err != nil || exists || stat != nil {
+		t.Fatalf("expected missing node to not exist, got exists: %v, stat: %+v, err: %v", exists, stat, err)
+	}
+
+	exists, stat, err = client.Exists(context.Background(), "/ephemeral")
+	if err != nil || !exists {
+		t.Fatalf("expected node to exist, got exists: %v, err: %v", exists, err)
+	}
+	if !stat.IsEphemeral() || stat.Owner() != sessionID {
+		t.Fatalf("expected node to be owned by session %x, got owner %x", sessionID, stat.Owner())
+	}
+	if expected := time.Unix(1, 500*int64(time.Millisecond)); !stat.Ctime.Equal(expected) {
+		t.Fatalf("expected ctime %v, got %v", expected, stat.Ctime)
+	}
+}
+
+func TestClientReadModifyWrite(t *testing.T) {
+	value, version := []byte("1"), int32(3)
+	server, err := testutils.NewServer(func(req jute.RecordReader) (Error, jute.RecordWriter) {
+		switch r := req.(type) {
+		case *proto.GetDataRequest:
+			return 0, &proto.GetDataResponse{Data: value, Stat: data.Stat{Version: version}}
+		case *proto.SetDataRequest:
+			if r.Version != version {
+				return ErrBadVersion, nil
+			}
+			value = r.Data
+			version++
+			return 0, &proto.SetDataResponse{Stat: data.Stat{Version: version}}
+		case *proto.GetChildren2Request:
+			return 0, &proto.GetChildren2Response{Children: []string{"child"}, Stat: data.Stat{Cversion: 1, NumChildren: 1}}
+		}
+
+		return testutils.DefaultHandler(req)
+	})
+	if err != nil {
+		t.Fatalf("error creating test server: %v", err)
+	}
+	defer server.Close()
+
+	client := &Client{
+		Network:  server.Addr().Network(),
+		Ensemble: server.Addr().String(),
+	}
+	defer client.Reset()
+
+	current, stat, err := client.GetDataWithStat(context.Background(), "/counter")
+	if err != nil {
+		t.Fatalf("unexpected error calling GetDataWithStat: %v", err)
+	}
+	if stat.Version != version {
+		t.Fatalf("getDataWithStat error: expected version %d, got %d", version, stat.Version)
+	}
+
+	if _, err = client.SetData(context.Background(), "/counter", append(current, '1'), stat.Version); err != nil {
+		t.Fatalf("unexpected error calling SetData: %v", err)
+	}
+	if expected := []byte("11"); !reflect.DeepEqual(expected, value) {
+		t.Fatalf("setData error: expected data %s, got %s", expected, value)
+	}
+
+	children, stat, err := client.GetChildrenWithStat(context.Background(), "/counter")
+	if err != nil {
+		t.Fatalf("unexpected error calling GetChildrenWithStat: %v", err)
+	}
+	if !reflect.DeepEqual([]string{"child"}, children) || stat.NumChildren != 1 {
+		t.Fatalf("getChildrenWithStat error: unexpected children %v, stat %+v", children, stat)
+	}
+}
+
+func TestClientSetACL(t *testing.T) {
+	var aversion int32
+	server, err := testutils.NewServer(func(req jute.RecordReader) (Error, jute.RecordWriter) {
+		if r, ok := req.(*proto.SetACLRequest); ok {
+			if r.Version != AnyVersion && r.Version != aversion {
+				return ErrBadVersion, nil
+			}
+			aversion++
+			return 0, &proto.SetACLResponse{Stat: data.Stat{Aversion: aversion}}
+		}
+
+		return testutils.DefaultHandler(req)
+	})
+	if err != nil {
+		t.Fatalf("error creating test server: %v", err)
+	}
+	defer server.Close()
+
+	client := &Client{
+		Network:  server.Addr().Network(),
+		Ensemble: server.Addr().String(),
+	}
+	defer client.Reset()
+
+	stat, err := client.SetACL(context.Background(), "/secure", ReadACLUnsafe, 0)
+	if err != nil {
+		t.Fatalf("unexpected error calling SetACL: %v", err)
+	}
+	if stat.Aversion != 1 {
+		t.Fatalf("setACL error: expected aversion 1, got %d", stat.Aversion)
+	}
+
+	if _, err = client.SetACL(context.Background(), "/secure", CreatorAllACL, 0); !errors.Is(err, ErrBadVersion) {
+		t.Fatalf("expected error %v, got: %v", ErrBadVersion, err)
+	}
+}
+
+func TestClientAddAuthReplayedOnReconnect(t *testing.T) {
+	authPackets := make(chan *proto.AuthPacket, 2)
+	server, err := testutils.NewServer(func(req jute.RecordReader) (Error, jute.RecordWriter) {
+		if auth, ok := req.(*proto.AuthPacket); ok {
+			authPackets <- auth
+		}
+
+		return testutils.DefaultHandler(req)
+	})
+	if err != nil {
+		t.Fatalf("error creating test server: %v", err)
+	}
+	defer server.Close()
+
+	client := &Client{
+		Network:  server.Addr().Network(),
+		Ensemble: server.Addr().String(),
+	}
+	defer client.Reset()
+
+	if err = client.AddAuth(context.Background(), "digest", []byte("user:password")); err != nil {
+		t.Fatalf("unexpected error calling AddAuth: %v", err)
+	}
+
+	// force the client to establish a new connection on the next call
+	if err = client.Reset(); err != nil {
+		t.Fatalf("unexpected error resetting client: %v", err)
+	}
+	if _, err = client.GetData(context.Background(), "/"); err != nil {
+		t.Fatalf("unexpected error calling GetData: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		auth := <-authPackets
+		if auth.Scheme != "digest" || string(auth.Auth) != "user:password" {
+			t.Fatalf("unexpected auth packet received by server: %+v", auth)
+		}
+	}
+}
+
+func TestClientLinearizableReads(t *testing.T) {
+	requests := make(chan jute.RecordReader, 4)
+	server, err := testutils.NewServer(func(req jute.RecordReader) (Error, jute.RecordWriter) {
+		requests <- req
+
+		return testutils.DefaultHandler(req)
+	})
+	if err != nil {
+		t.Fatalf("error creating test server: %v", err)
+	}
+	defer server.Close()
+
+	client := &Client{
+		Network:           server.Addr().Network(),
+		Ensemble:          server.Addr().String(),
+		LinearizableReads: true,
+	}
+	defer client.Reset()
+
+	if _, err = client.GetData(context.Background(), "/leader"); err != nil {
+		t.Fatalf("unexpected error calling GetData: %v", err)
+	}
+	if _, err = client.GetChildren(context.Background(), "/leader"); err != nil {
+		t.Fatalf("unexpected error calling GetChildren: %v", err)
+	}
+
+	// every read is expected to be preceded by a sync of the same path
+	for i := 0; i < 2; i++ {
+		sync, ok := (<-requests).(*proto.SyncRequest)
+		if !ok || sync.Path != "/leader" {
+			t.Fatalf("expected sync request for /leader before read, got %+v", sync)
+		}
+		if req := <-requests; reflect.TypeOf(req) == reflect.TypeOf(sync) {
+			t.Fatalf("expected read request after sync, got %+v", req)
+		}
+	}
+}
+
+func TestClientGetEphemeralsAndChildrenNumber(t *testing.T) {
+	server, err := testutils.NewDefaultServer()
+	if err != nil {
+		t.Fatalf("error creating test server: %v", err)
+	}
+	defer server.Close()
+
+	client := &Client{
+		Network:  server.Addr().Network(),
+		Ensemble: server.Addr().String(),
+	}
+	defer client.Reset()
+
+	ephemerals, err := client.GetEphemerals(context.Background(), "/services/")
+	if err != nil {
+		t.Fatalf("unexpected error calling GetEphemerals: %v", err)
+	}
+	if expected := []string{"/services/test"}; !reflect.DeepEqual(expected, ephemerals) {
+		t.Fatalf("getEphemerals error: expected %v, got %v", expected, ephemerals)
+	}
+
+	number, err := client.GetAllChildrenNumber(context.Background(), "/services")
+	if err != nil {
+		t.Fatalf("unexpected error calling GetAllChildrenNumber: %v", err)
+	}
+	if number != 1 {
+		t.Fatalf("getAllChildrenNumber error: expected 1, got %d", number)
+	}
+}
+
+func TestClientQuota(t *testing.T) {
+	// emulate a server holding a small tree of znodes
+	tree := map[string][]byte{"/zookeeper": nil, "/zookeeper/quota": nil, "/tenants": nil, "/tenants/a": nil}
+	hasChildren := func(path string) bool {
+		for node := range tree {
+			if strings.HasPrefix(node, path+"/") {
+				return true
+			}
+		}
+		return false
+	}
+	server, err := testutils.NewServer(func(req jute.RecordReader) (Error, jute.RecordWriter) {
+		switch r := req.(type) {
+		case *proto.CreateRequest:
+			if _, ok := tree[r.Path]; ok {
+				return ErrNodeExists, nil
+			}
+			if _, ok := tree[r.Path[:strings.LastIndex(r.Path, "/")]]; !ok {
+				return ErrNoNode, nil
+			}
+			tree[r.Path] = r.Data
+			return 0, &proto.CreateResponse{Path: r.Path}
+		case *proto.ExistsRequest:
+			if _, ok := tree[r.Path]; !ok {
+				return ErrNoNode, nil
+			}
+			return 0, &proto.ExistsResponse{}
+		case *proto.GetDataRequest:
+			value, ok := tree[r.Path]
+			if !ok {
+				return ErrNoNode, nil
+			}
+			return 0, &proto.GetDataResponse{Data: value}
+		case *proto.SetDataRequest:
+			tree[r.Path] = r.Data
+			return 0, &proto.SetDataResponse{}
+		case *proto.DeleteRequest:
+			if hasChildren(r.Path) {
+				return ErrNotEmpty, nil
+			}
+			delete(tree, r.Path)
+			return 0, &testutils.EmptyResponse{}
+		}
+
+		return testutils.DefaultHandler(req)
+	})
+	if err != nil {
+		t.Fatalf("error creating test server: %v", err)
+	}
+	defer server.Close()
+
+	client := &Client{
+		Network:  server.Addr().Network(),
+		Ensemble: server.Addr().String(),
+	}
+	defer client.Reset()
+
+	limits := Quota{Count: 100, Bytes: -1, CountHardLimit: 200}
+	if err = client.SetQuota(context.Background(), "/tenants/a", limits); err != nil {
+		t.Fatalf("unexpected error calling SetQuota: %v", err)
+	}
+	if value := string(tree["/zookeeper/quota/tenants/a/zookeeper_limits"]); value != "count=100,bytes=-1,countHardLimit=200" {
+		t.Fatalf("setQuota error: unexpected limits node data %q", value)
+	}
+
+	// updating the quota overwrites the existing limits
+	limits.Bytes = 1024
+	if err = client.SetQuota(context.Background(), "/tenants/a", limits); err != nil {
+		t.Fatalf("unexpected error updating quota: %v", err)
+	}
+
+	listed, stats, err := client.ListQuota(context.Background(), "/tenants/a")
+	if err != nil {
+		t.Fatalf("unexpected error calling ListQuota: %v", err)
+	}
+	if expected := (Quota{Count: 100, Bytes: 1024, CountHardLimit: 200, BytesHardLimit: -1}); *listed != expected {
+		t.Fatalf("listQuota error: expected limits %+v, got %+v", expected, listed)
+	}
+	if stats.Count != 0 || stats.Bytes != 0 {
+		t.Fatalf("listQuota error: unexpected stats %+v", stats)
+	}
+
+	if err = client.DeleteQuota(context.Background(), "/tenants/a"); err != nil {
+		t.Fatalf("unexpected error calling DeleteQuota: %v", err)
+	}
+	if hasChildren("/zookeeper/quota/tenants/a") {
+		t.Fatalf("deleteQuota error: quota nodes were not removed")
+	}
+
+	if err = client.SetQuota(context.Background(), "/tenants/missing", limits); !errors.Is(err, ErrNoNode) {
+		t.Fatalf("expected error %v, got: %v", ErrNoNode, err)
+	}
+}
+
+func TestClientTLSCertificateRotation(t *testing.T) {
+	serverCert, serverKey, err := testutils.GenerateCertificate("127.0.0.1")
+	if err != nil {
+		t.Fatalf("error generating server certificate: %v", err)
+	}
+	serverPair, err := tls.X509KeyPair(serverCert, serverKey)
+	if err != nil {
+		t.Fatalf("error loading server certificate: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	clientCAs := x509.NewCertPool()
+	writeClientCertificate := func(name string, modTime time.Time) {
+		cert, key, err := testutils.GenerateCertificate(name)
+		if err != nil {
+			t.Fatalf("error generating client certificate: %v", err)
+		}
+		clientCAs.AppendCertsFromPEM(cert)
+		for file, contents := range map[string][]byte{certFile: cert, keyFile: key} {
+			if err = os.WriteFile(file, contents, 0600); err != nil {
+				t.Fatalf("error writing client certificate: %v", err)
+			}
+			if err = os.Chtimes(file, modTime, modTime); err != nil {
+				t.Fatalf("error updating client certificate modification time: %v", err)
+			}
+		}
+	}
+	writeClientCertificate("client-1", time.Now().Add(-time.Minute))
+
+	clientNames := make(chan string, 2)
+	server, err := testutils.NewTLSServer(testutils.DefaultHandler, &tls.Config{
+		Certificates: []tls.Certificate{serverPair},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			clientNames <- state.PeerCertificates[0].Subject.CommonName
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("error creating test server: %v", err)
+	}
+	defer server.Close()
+
+	reloader, err := NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("unexpected error loading client certificate: %v", err)
+	}
+	rootCAs := x509.NewCertPool()
+	rootCAs.AppendCertsFromPEM(serverCert)
+
+	client := &Client{
+		Network:  server.Addr().Network(),
+		Ensemble: server.Addr().String(),
+		TLSConfig: &tls.Config{
+			RootCAs:              rootCAs,
+			GetClientCertificate: reloader.GetClientCertificate,
+		},
+	}
+	defer client.Reset()
+
+	if _, err = client.GetData(context.Background(), "/"); err != nil {
+		t.Fatalf("unexpected error calling GetData: %v", err)
+	}
+	if name := <-clientNames; name != "client-1" {
+		t.Fatalf("unexpected client certificate presented: %s", name)
+	}
+
+	// rotate the certificate and force the client to establish a new connection
+	writeClientCertificate("client-2", time.Now())
+	if err = client.Reset(); err != nil {
+		t.Fatalf("unexpected error resetting client: %v", err)
+	}
+	if _, err = client.GetData(context.Background(), "/"); err != nil {
+		t.Fatalf("unexpected error calling GetData: %v", err)
+	}
+	if name := <-clientNames; name != "client-2" {
+		t.Fatalf("unexpected client certificate presented after rotation: %s", name)
+	}
+}
+
+func TestClientWatchesRestoredOnReconnect(t *testing.T) {
+	setWatches := make(chan *proto.SetWatches2, 1)
+	server, err := testutils.NewServer(func(req jute.RecordReader) (Error, jute.RecordWriter) {
+		switch r := req.(type) {
+		case *proto.SetWatches2:
+			setWatches <- r
+		case *proto.ExistsRequest:
+			if r.Path == "/missing" {
+				return ErrNoNode, nil
+			}
+		}
+
+		return testutils.DefaultHandler(req)
+	})
+	if err != nil {
+		t.Fatalf("error creating test server: %v", err)
+	}
+	defer server.Close()
+
+	client := &Client{
+		Network:  server.Addr().Network(),
+		Ensemble: server.Addr().String(),
+	}
+	defer client.Reset()
+
+	_, _, dataEvents, err := client.GetDataW(context.Background(), "/data")
+	if err != nil {
+		t.Fatalf("unexpected error calling GetDataW: %v", err)
+	}
+	if _, _, _, err = client.ExistsW(context.Background(), "/missing"); err != nil {
+		t.Fatalf("unexpected error calling ExistsW: %v", err)
+	}
+	if _, _, _, err = client.GetChildrenW(context.Background(), "/children"); err != nil {
+		t.Fatalf("unexpected error calling GetChildrenW: %v", err)
+	}
+	if _, err = client.AddWatch(context.Background(), "/config", AddWatchModePersistentRecursive); err != nil {
+		t.Fatalf("unexpected error calling AddWatch: %v", err)
+	}
+
+	// force the client to establish a new connection on the next call
+	if err = client.Reset(); err != nil {
+		t.Fatalf("unexpected error resetting client: %v", err)
+	}
+	if _, err = client.GetData(context.Background(), "/"); err != nil {
+		t.Fatalf("unexpected error calling GetData: %v", err)
+	}
+
+	restored := <-setWatches
+	// the test server increments the zxid for every request, so the last zxid seen is that of the AddWatch reply
+	if restored.RelativeZxid != 4 {
+		t.Fatalf("expected watches to be restored relative to zxid 4, got %d", restored.RelativeZxid)
+	}
+	expected := [][]string{{"/data"}, {"/missing"}, {"/children"}, {"/config"}}
+	actual := [][]string{restored.DataWatches, restored.ExistWatches, restored.ChildWatches, restored.PersistentRecursiveWatches}
+	if !reflect.DeepEqual(expected, actual) || len(restored.PersistentWatches) != 0 {
+		t.Fatalf("unexpected watches restored: %+v", restored)
+	}
+
+	select {
+	case _, ok := <-dataEvents:
+		t.Fatalf("expected watch channel to stay open across reconnects, received value: %v", ok)
+	default:
+	}
+}
+
+func TestClientWatchesRestoredWithSetWatches(t *testing.T) {
+	setWatches := make(chan *proto.SetWatches, 1)
+	setWatches2 := make(chan *proto.SetWatches2, 1)
+	server, err := testutils.NewServer(func(req jute.RecordReader) (Error, jute.RecordWriter) {
+		switch r := req.(type) {
+		case *proto.SetWatches:
+			setWatches <- r
+		case *proto.SetWatches2:
+			setWatches2 <- r
+		}
+
+		return testutils.DefaultHandler(req)
+	})
+	if err != nil {
+		t.Fatalf("error creating test server: %v", err)
+	}
+	defer server.Close()
+
+	client := &Client{
+		Network:  server.Addr().Network(),
+		Ensemble: server.Addr().String(),
+	}
+	defer client.Reset()
+
+	if _, _, _, err = client.GetDataW(context.Background(), "/data"); err != nil {
+		t.Fatalf("unexpected error calling GetDataW: %v", err)
+	}
+	if _, _, _, err = client.GetChildrenW(context.Background(), "/children"); err != nil {
+		t.Fatalf("unexpected error calling GetChildrenW: %v", err)
+	}
+
+	if err = client.Reset(); err != nil {
+		t.Fatalf("unexpected error resetting client: %v", err)
+	}
+	if _, err = client.GetData(context.Background(), "/"); err != nil {
+		t.Fatalf("unexpected error calling GetData: %v", err)
+	}
+
+	restored := <-setWatches
+	expected := [][]string{{"/data"}, {"/children"}}
+	if actual := [][]string{restored.DataWatches, restored.ChildWatches}; !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("unexpected watches restored: %+v", restored)
+	}
+	// servers before Zookeeper 3.6 do not support SetWatches2, so it must not be sent for one-shot watches
+	select {
+	case request := <-setWatches2:
+		t.Fatalf("unexpected SetWatches2 request sent without persistent watches: %+v", request)
+	default:
+	}
+}
+
+func TestClientSessionEvents(t *testing.T) {
+	server, err := testutils.NewServer(func(req jute.RecordReader) (Error, jute.RecordWriter) {
+		if auth, ok := req.(*proto.AuthPacket); ok && string(auth.Auth) == "user:wrong" {
+			return ErrAuthFailed, nil
+		}
+
+		return testutils.DefaultHandler(req)
+	})
+	if err != nil {
+		t.Fatalf("error creating test server: %v", err)
+	}
+	defer server.Close()
+
+	events := make(chan SessionEvent, 10)
+	client := &Client{
+		Network:             server.Addr().Network(),
+		Ensemble:            server.Addr().String(),
+		SessionEventHandler: func(event SessionEvent) { events <- event },
+	}
+
+	if _, err = client.GetData(context.Background(), "/"); err != nil {
+		t.Fatalf("unexpected error calling GetData: %v", err)
+	}
+	if err = client.AddAuth(context.Background(), "digest", []byte("user:wrong")); err == nil {
+		t.Fatalf("expected AddAuth to fail")
+	}
+	if err = client.Reset(); err != nil {
+		t.Fatalf("unexpected error resetting client: %v", err)
+	}
+
+	expected := []SessionState{SessionStateConnecting, SessionStateConnected, SessionStateAuthFailed, SessionStateDisconnected}
+	for _, state := range expected {
+		event := <-events
+		if event.State != state || event.Server != server.Addr().String() {
+			t.Fatalf("session event error: expected state %v, got %+v", state, event)
+		}
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected session event after disconnecting: %+v", event)
+	default:
+	}
+}
+
+func TestClientResetFromSessionEventHandler(t *testing.T) {
+	server, err := testutils.NewDefaultServer()
+	if err != nil {
+		t.Fatalf("error creating test server: %v", err)
+	}
+	defer server.Close()
+
+	client := &Client{
+		Network:  server.Addr().Network(),
+		Ensemble: server.Addr().String(),
+	}
+	client.SessionEventHandler = func(event SessionEvent) {
+		if event.State == SessionStateDisconnected {
+			client.Reset()
+		}
+	}
+
+	if _, err = client.GetData(context.Background(), "/"); err != nil {
+		t.Fatalf("unexpected error calling GetData: %v", err)
+	}
+
+	reset := make(chan error, 1)
+	go func() { reset <- client.Reset() }()
+	select {
+	case <-reset:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Reset deadlocked when called from the session event handler")
+	}
+}
+
+func TestClientSessionResumption(t *testing.T) {
+	server, err := testutils.NewDefaultServer()
+	if err != nil {
+		t.Fatalf("error creating test server: %v", err)
+	}
+	defer server.Close()
+
+	connected := make(chan SessionEvent, 10)
+	expired := make(chan SessionEvent, 10)
+	client := &Client{
+		MaxRetries: 1,
+		Network:    server.Addr().Network(),
+		Ensemble:   server.Addr().String(),
+		SessionEventHandler: func(event SessionEvent) {
+			switch event.State {
+			case SessionStateConnected:
+				connected <- event
+			case SessionStateExpired:
+				expired <- event
+			}
+		},
+	}
+	defer client.Reset()
+
+	reconnect := func() SessionEvent {
+		if err = client.Reset(); err != nil {
+			t.Fatalf("unexpected error resetting client: %v", err)
+		}
+		if _, err = client.GetData(context.Background(), "/"); err != nil {
+			t.Fatalf("unexpected error calling GetData: %v", err)
+		}
+		return <-connected
+	}
+
+	if _, err = client.GetData(context.Background(), "/"); err != nil {
+		t.Fatalf("unexpected error calling GetData: %v", err)
+	}
+	session := <-connected
+	if session.SessionID == 0 {
+		t.Fatalf("expected a session to be established")
+	}
+	if resumed := reconnect(); resumed.SessionID != session.SessionID {
+		t.Fatalf("expected session 0x%x to be resumed, got 0x%x", session.SessionID, resumed.SessionID)
+	}
+
+	// the call which finds the session expired fails without retrying, after which a new session is established
+	server.ExpireSessions()
+	if err = client.Reset(); err != nil {
+		t.Fatalf("unexpected error resetting client: %v", err)
+	}
+	if _, err = client.GetData(context.Background(), "/"); !errors.Is(err, ErrSessionExpired) {
+		t.Fatalf("expected GetData to return ErrSessionExpired, got %v", err)
+	}
+	if event := <-expired; !errors.Is(event.Err, ErrSessionExpired) || event.SessionID != session.SessionID {
+		t.Fatalf("unexpected expired session event: %+v", event)
+	}
+	if _, err = client.GetData(context.Background(), "/"); err != nil {
+		t.Fatalf("unexpected error calling GetData: %v", err)
+	}
+	if renewed := <-connected; renewed.SessionID == session.SessionID || renewed.SessionID == 0 {
+		t.Fatalf("expected a new session to be established after 0x%x expired, got 0x%x", session.SessionID, renewed.SessionID)
+	}
+}
+
+func TestClientEnsembleFailover(t *testing.T) {
+	server, err := testutils.NewDefaultServer()
+	if err != nil {
+		t.Fatalf("error creating test server: %v", err)
+	}
+	defer server.Close()
+
+	// reserve an address on which no server is listening
+	unavailable, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatalf("error creating listener: %v", err)
+	}
+	unavailable.Close()
+
+	client := &Client{
+		Network:  server.Addr().Network(),
+		Ensemble: unavailable.Addr().String() + "," + server.Addr().String(),
+	}
+	defer client.Reset()
+
+	if server := client.Server(); server != "" {
+		t.Fatalf("expected no server before connecting, got %s", server)
+	}
+	// both connections succeed regardless of the order the hosts were shuffled in
+	for i := 0; i < 2; i++ {
+		if _, err = client.GetData(context.Background(), "/"); err != nil {
+			t.Fatalf("unexpected error calling GetData: %v", err)
+		}
+		if connected := client.Server(); connected != server.Addr().String() {
+			t.Fatalf("expected client to be connected to %s, got %s", server.Addr(), connected)
+		}
+		if err = client.Reset(); err != nil {
+			t.Fatalf("unexpected error resetting client: %v", err)
+		}
+	}
+}
+
+func TestClientUnixEnsemble(t *testing.T) {
+	created := make(chan string, 1)
+	server, err := testutils.NewServer(func(req jute.RecordReader) (Error, jute.RecordWriter) {
+		if create, ok := req.(*proto.CreateRequest); ok {
+			created <- create.Path
+		}
+
+		return testutils.DefaultHandler(req)
+	})
+	if err != nil {
+		t.Fatalf("error creating test server: %v", err)
+	}
+	defer server.Close()
+
+	dialed := make(chan string, 1)
+	client := &Client{
+		Network:  "unix",
+		Ensemble: "/var/run/zk/client.sock",
+		// the test server only listens on TCP, so the socket path is only recorded
+		Dialer: func(ctx context.Context, network, address string) (net.Conn, error) {
+			dialed <- network + " " + address
+			return net.Dial(server.Addr().Network(), server.Addr().String())
+		},
+	}
+	defer client.Reset()
+
+	if _, err = client.Create(context.Background(), "/node", nil, CreateModePersistent, OpenACLUnsafe); err != nil {
+		t.Fatalf("unexpected error calling Create: %v", err)
+	}
+	if address := <-dialed; address != "unix /var/run/zk/client.sock" {
+		t.Fatalf("expected the ensemble to be dialed as a single unix address, got %q", address)
+	}
+	if path := <-created; path != "/node" {
+		t.Fatalf("expected the socket path not to be used as a chroot, got request path %s", path)
+	}
+}
+
+func TestClientReadOnly(t *testing.T) {
+	servers := make(map[string]*testutils.TestServer)
+	for i := 0; i < 2; i++ {
+		server, err := testutils.NewDefaultServer()
+		if err != nil {
+			t.Fatalf("error creating test server: %v", err)
+		}
+		defer server.Close()
+
+		server.SetReadOnly(true)
+		servers[server.Addr().String()] = server
+	}
+	var ensemble []string
+	for address := range servers {
+		ensemble = append(ensemble, address)
+	}
+
+	events := make(chan SessionEvent, 10)
+	client := &Client{
+		Network:             "tcp",
+		Ensemble:            strings.Join(ensemble, ","),
+		ReadOnly:            true,
+		SessionEventHandler: func(event SessionEvent) { events <- event },
+	}
+	defer client.Reset()
+
+	if _, err := client.GetData(context.Background(), "/"); err != nil {
+		t.Fatalf("unexpected error calling GetData: %v", err)
+	}
+	if _, err := client.Create(context.Background(), "/node", nil, CreateModePersistent, OpenACLUnsafe); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly for a write to a read-only server, got %v", err)
+	}
+	for _, state := range []SessionState{SessionStateConnecting, SessionStateConnectedReadOnly} {
+		if event := <-events; event.State != state {
+			t.Fatalf("session event error: expected state %v, got %+v", state, event)
+		}
+	}
+
+	// once the other server joins the quorum, the client drops its read-only connection
+	var readWrite string
+	for address, server := range servers {
+		if address != client.Server() {
+			readWrite = address
+			server.SetReadOnly(false)
+		}
+	}
+	// the quorum has committed transactions since, so the read-write server is not behind the client
+	other := &Client{Network: "tcp", Ensemble: readWrite}
+	for i := 0; i < 10; i++ {
+		if _, err := other.GetData(context.Background(), "/"); err != nil {
+			t.Fatalf("unexpected error calling GetData: %v", err)
+		}
+	}
+	other.Reset()
+	if event := <-events; event.State != SessionStateDisconnected {
+		t.Fatalf("expected the read-only connection to be closed, got %+v", event)
+	}
+
+	if _, err := client.GetData(context.Background(), "/"); err != nil {
+		t.Fatalf("unexpected error calling GetData: %v", err)
+	}
+	if connected := client.Server(); connected != readWrite {
+		t.Fatalf("expected client to reconnect to read-write server %s, got %s", readWrite, connected)
+	}
+	for _, state := range []SessionState{SessionStateConnecting, SessionStateConnected} {
+		if event := <-events; event.State != state || event.Server != readWrite {
+			t.Fatalf("session event error: expected state %v, got %+v", state, event)
+		}
+	}
+}
+
+func TestClientLastZxid(t *testing.T) {
+	servers := make(map[string]bool)
+	var ensemble []string
+	for i := 0; i < 2; i++ {
+		server, err := testutils.NewDefaultServer()
+		if err != nil {
+			t.Fatalf("error creating test server: %v", err)
+		}
+		defer server.Close()
+
+		servers[server.Addr().String()] = true
+		ensemble = append(ensemble, server.Addr().String())
+	}
+
+	client := &Client{
+		MaxRetries: 1,
+		Network:    "tcp",
+		Ensemble:   strings.Join(ensemble, ","),
+	}
+	defer client.Reset()
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.GetData(context.Background(), "/"); err != nil {
+			t.Fatalf("unexpected error calling GetData: %v", err)
+		}
+	}
+	if zxid := client.LastZxid(); zxid != 3 {
+		t.Fatalf("expected last zxid to be 3, got %d", zxid)
+	}
+
+	// the other server has not seen any transaction yet, so it refuses the session and the client fails back
+	server := client.Server()
+	if err := client.Reset(); err != nil {
+		t.Fatalf("unexpected error resetting client: %v", err)
+	}
+	if _, err := client.GetData(context.Background(), "/"); err != nil {
+		t.Fatalf("unexpected error calling GetData: %v", err)
+	}
+	if connected := client.Server(); connected != server {
+		t.Fatalf("expected client to reconnect to %s, which is not behind it, got %s", server, connected)
+	}
+	if zxid := client.LastZxid(); zxid != 4 {
+		t.Fatalf("expected last zxid to be 4, got %d", zxid)
+	}
+}
+
+func TestClientChroot(t *testing.T) {
+	created := make(chan string, 1)
+	server, err := testutils.NewServer(func(req jute.RecordReader) (Error, jute.RecordWriter) {
+		if create, ok := req.(*proto.CreateRequest); ok {
+			created <- create.Path
+		}
+
+		return testutils.DefaultHandler(req)
+	})
+	if err != nil {
+		t.Fatalf("error creating test server: %v", err)
+	}
+	defer server.Close()
+
+	client := &Client{
+		Network:  server.Addr().Network(),
+		Ensemble: server.Addr().String() + "/tenants/app",
+	}
+	defer client.Reset()
+
+	path, err := client.Create(context.Background(), "/node", nil, CreateModePersistent, OpenACLUnsafe)
+	if err != nil || path != "/node" {
+		t.Fatalf("unexpected Create result %q: %v", path, err)
+	}
+	if serverPath := <-created; serverPath != "/tenants/app/node" {
+		t.Fatalf("expected request path to be prefixed with the chroot, got %s", serverPath)
+	}
+
+	if err = client.SetQuota(context.Background(), "/node", Quota{Count: 10, Bytes: -1}); err == nil {
+		t.Fatalf("expected quotas to be rejected for a chrooted client")
+	}
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package zk
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// configPath is the znode which holds the dynamic configuration of the ensemble.
+const configPath = "/zookeeper/config"
+
+// EnsembleConfig is the dynamic configuration of a Zookeeper ensemble, as stored in /zookeeper/config.
+// ref: https://zookeeper.apache.org/doc/current/zookeeperReconfig.html
+type EnsembleConfig struct {
+	Members []EnsembleMember
+	// Version is the zxid of the reconfiguration which produced this config.
+	// It can be passed to Reconfig in order to make the reconfiguration conditional.
+	Version int64
+}
+
+// EnsembleMember is a single server of the ensemble, parsed from a "server.N=host:peer:election:role;clientaddr" line.
+type EnsembleMember struct {
+	ID           int64
+	Host         string
+	PeerPort     int
+	ElectionPort int
+	Role         string // "participant" or "observer"
+	ClientAddr   string // address clients connect to, empty if the server has no client address configured
+}
+
+// String formats the member in the format used by the server, which is also accepted by Reconfig.
+func (m EnsembleMember) String() string {
+	host := m.Host
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	member := fmt.Sprintf("server.%d=%s:%d:%d:%s", m.ID, host, m.PeerPort, m.ElectionPort, m.Role)
+	if m.ClientAddr != "" {
+		member += ";" + m.ClientAddr
+	}
+
+	return member
+}
+
+// parseConfig parses the dynamic configuration, ignoring lines other than the server list and version.
+func parseConfig(data []byte) (*EnsembleConfig, error) {
+	config := &EnsembleConfig{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		key, value := line, ""
+		if idx := strings.Index(line, "="); idx != -1 {
+			key, value = line[:idx], line[idx+1:]
+		}
+
+		switch {
+		case key == "version":
+			version, err := strconv.ParseInt(value, 16, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid config version %q: %w", value, err)
+			}
+			config.Version = version
+		case strings.HasPrefix(key, "server."):
+			id, err := strconv.ParseInt(strings.TrimPrefix(key, "server."), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid server id in config line %q: %w", line, err)
+			}
+			member, err := parseMember(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid config line %q: %w", line, err)
+			}
+			member.ID = id
+			config.Members = append(config.Members, *member)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading config: %w", err)
+	}
+
+	return config, nil
+}
+
+// parseMember parses the "host:peer:election[:role][;clientaddr]" part of a server config line.
+func parseMember(value string) (*EnsembleMember, error) {
+	member := &EnsembleMember{Role: "participant"}
+
+	serverAddr := value
+	if idx := strings.Index(value, ";"); idx != -1 {
+		serverAddr, member.ClientAddr = value[:idx], value[idx+1:]
+		if !strings.Contains(member.ClientAddr, ":") {
+			// only the client port is configured, in which case the server listens on all addresses
+			member.ClientAddr = "0.0.0.0:" + member.ClientAddr
+		}
+	}
+
+	// split from the right, since IPv6 hosts contain colons themselves
+	parts := strings.Split(serverAddr, ":")
+	if last := parts[len(parts)-1]; last == "participant" || last == "observer" {
+		member.Role = last
+		parts = parts[:len(parts)-1]
+	}
+	if len(parts) < 3 {
+		return nil, fmt.Errorf("expected host:peerPort:electionPort, got %q", serverAddr)
+	}
+
+	var err error
+	if member.ElectionPort, err = strconv.Atoi(parts[len(parts)-1]); err != nil {
+		return nil, fmt.Errorf("invalid election port: %w", err)
+	}
+	if member.PeerPort, err = strconv.Atoi(parts[len(parts)-2]); err != nil {
+		return nil, fmt.Errorf("invalid peer port: %w", err)
+	}
+	member.Host = strings.Trim(strings.Join(parts[:len(parts)-2], ":"), "[]")
+
+	return member, nil
+}
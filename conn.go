@@ -15,6 +15,7 @@ import (
 	"io"
 	"log"
 	"net"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -25,26 +26,57 @@ import (
 )
 
 const defaultTimeout = 2 * time.Second
+const sessionPasswdLength = 16
 const overflowBitMask = 1<<31 - 1
 
+// AnyVersion can be used as the expected version in versioned calls such as SetData and Delete
+// in order to skip the server-side version check.
+const AnyVersion = -1
+
 // Conn represents a client connection to a Zookeeper server and parameters needed to handle its lifetime.
 type Conn struct {
+	// the highest zxid seen in a reply, accessed atomically and kept first for 64-bit alignment on 32-bit platforms
+	lastZxid int64
+
 	conn net.Conn
 
 	// client-side request ID
 	xid int32
+	// the session credentials assigned by the server, which are presented to resume the session on a new connection
+	sessionID int64
+	passwd    []byte
+	// readOnly is set if the server only accepts read requests, as it is partitioned from the ensemble's quorum
+	readOnly bool
 	// the client sends a requested timeout, the server responds with the timeout that it can give the client
 	sessionTimeout time.Duration
 
 	reqs          sync.Map
 	cancelSession context.CancelFunc
 	sessionCtx    context.Context
+
+	// AddAuth calls share the same xid, so only one of them can be in-flight at a time
+	authLock sync.Mutex
+
+	watches *watchManager
+	// keepWatches is set for connections dialed by a Client, which restores the watches on its next connection
+	keepWatches bool
+
+	// the path which all paths sent to and received from the server are relative to, see Client.Chroot
+	chroot string
+
+	// the address of the server and the handler for session events, which are set by the dialing Client
+	server              string
+	sessionEventHandler func(SessionEvent)
+	// closed is set by the first call closing the connection, which reports the disconnected event, accessed atomically
+	closed int32
 }
 
 type pendingRequest struct {
 	reply jute.RecordReader
 	done  chan struct{}
 	error error
+	// watch is registered by the read loop before the reply is handed over, so no notification can be missed
+	watch *watchRegistration
 }
 
 // isAlive() checks the TCP connection is alive by reading from the sessionCtx channel.
@@ -66,29 +98,82 @@ func DialContext(ctx context.Context, network, address string) (*Conn, error) {
 // DialContext connects the ZK client to the specified Zookeeper server.
 // The provided context is used to determine the dial lifetime.
 func (client *Client) DialContext(ctx context.Context, network, address string) (*Conn, error) {
+	return client.dialContext(ctx, network, address, nil)
+}
+
+// dialContext connects to the specified Zookeeper server. If session is not nil, the session is resumed
+// and the connection registers its watches in the session instead of tracking them itself,
+// leaving them open when it is closed.
+func (client *Client) dialContext(ctx context.Context, network, address string, session *sessionState) (*Conn, error) {
 	if client.Dialer == nil {
 		defaultDialer := &net.Dialer{}
 		client.Dialer = defaultDialer.DialContext
 	}
 
+	chroot, err := normalizeChroot(client.chrootPath())
+	if err != nil {
+		return nil, err
+	}
+
+	client.notifySession(SessionStateConnecting, address, nil)
 	conn, err := client.Dialer(ctx, network, address)
 	if err != nil {
-		return nil, fmt.Errorf("could not dial ZK server: %w", err)
+		err = fmt.Errorf("could not dial ZK server: %w", err)
+		client.notifySession(SessionStateDisconnected, address, err)
+		return nil, err
+	}
+	if client.TLSConfig != nil {
+		tlsConn, err := dialTLS(ctx, conn, address, client.TLSConfig)
+		if err != nil {
+			conn.Close()
+			err = fmt.Errorf("could not establish TLS connection to ZK server: %w", err)
+			client.notifySession(SessionStateDisconnected, address, err)
+			return nil, err
+		}
+		conn = tlsConn
 	}
 
 	sessionCtx, cancel := context.WithCancel(context.Background())
 	c := &Conn{
-		conn:           conn,
-		sessionTimeout: defaultTimeout,
-		cancelSession:  cancel,
-		sessionCtx:     sessionCtx,
+		chroot:              chroot,
+		conn:                conn,
+		sessionTimeout:      defaultTimeout,
+		cancelSession:       cancel,
+		sessionCtx:          sessionCtx,
+		watches:             newWatchManager(),
+		server:              address,
+		sessionEventHandler: client.SessionEventHandler,
+	}
+	if session != nil {
+		c.sessionID, c.passwd, c.lastZxid = session.id, session.passwd, session.lastZxid
+		c.watches, c.keepWatches = session.watches, true
 	}
 
 	if client.SessionTimeout != 0 {
 		c.sessionTimeout = client.SessionTimeout
 	}
-	if err = c.authenticate(); err != nil {
-		return nil, fmt.Errorf("could not authenticate with ZK server: %w", err)
+	if err = c.authenticate(client.ReadOnly); err != nil {
+		conn.Close()
+		err = fmt.Errorf("could not authenticate with ZK server: %w", err)
+		if errors.Is(err, ErrSessionExpired) {
+			c.notifySession(SessionStateExpired, err)
+		} else {
+			c.notifySession(SessionStateDisconnected, err)
+		}
+		return nil, err
+	}
+	if client.SASL != nil {
+		if err = c.authenticateSASL(client.SASL); err != nil {
+			conn.Close()
+			err = fmt.Errorf("could not complete SASL authentication: %w", err)
+			client.notifySession(SessionStateAuthFailed, address, err)
+			return nil, err
+		}
+	}
+	if c.readOnly {
+		c.notifySession(SessionStateConnectedReadOnly, nil)
+	} else {
+		c.notifySession(SessionStateConnected, nil)
 	}
 
 	go c.handleReads()
@@ -98,20 +183,49 @@ func (client *Client) DialContext(ctx context.Context, network, address string)
 }
 
 // Close closes the client connection, clearing all pending requests.
+// The channels of watches set through the connection are closed, since they can no longer be triggered.
 func (c *Conn) Close() error {
+	return c.closeWithError(nil)
+}
+
+// closeWithError closes the connection, reporting the cause in the disconnected session event.
+// Only the first call reports an event, as the connection is closed by both the read and keepalive loops on failure.
+// The event is reported once the connection is closed, so that the handler can close the connection itself.
+func (c *Conn) closeWithError(cause error) error {
+	first := atomic.CompareAndSwapInt32(&c.closed, 0, 1)
 	c.cancelSession()
 	c.clearPendingRequests()
+	if c.watches != nil && !c.keepWatches {
+		c.watches.closeAll()
+	}
+
+	err := c.conn.Close()
+	if first {
+		c.notifySession(SessionStateDisconnected, cause)
+	}
 
-	return c.conn.Close()
+	return err
 }
 
-func (c *Conn) authenticate() error {
+// authenticate establishes the session with the server, resuming the connection's session if it has one.
+// If allowReadOnly is set, the server may accept the session even if it is partitioned from the ensemble's quorum,
+// in which case the connection is read-only.
+func (c *Conn) authenticate(allowReadOnly bool) error {
+	// the Java client sends an empty password of the same length when requesting a new session
+	passwd := c.passwd
+	if passwd == nil {
+		passwd = make([]byte, sessionPasswdLength)
+	}
+
 	// create and encode request for zk server
 	request := &proto.ConnectRequest{
-		TimeOut: int32(c.sessionTimeout.Milliseconds()),
+		LastZxidSeen: int64(c.LastZxid()),
+		TimeOut:      int32(c.sessionTimeout.Milliseconds()),
+		SessionId:    c.sessionID,
+		Passwd:       passwd,
 	}
 
-	if err := WriteRecords(c.conn, request); err != nil {
+	if err := WriteRecords(c.conn, request, readOnlyFlag(allowReadOnly)); err != nil {
 		return fmt.Errorf("could not write authentication request: %w", err)
 	}
 
@@ -126,28 +240,193 @@ func (c *Conn) authenticate() error {
 		return fmt.Errorf("could not decode authentication response: %w", err)
 	}
 
-	if response.TimeOut > 0 {
-		c.sessionTimeout = time.Duration(response.TimeOut) * time.Millisecond
+	// the server responds with a non-positive timeout if the session could not be resumed
+	if response.TimeOut <= 0 {
+		code := Error(errExpired)
+		return fmt.Errorf("session 0x%x could not be resumed: %w", c.sessionID, &code)
+	}
+	c.sessionTimeout = time.Duration(response.TimeOut) * time.Millisecond
+	c.sessionID, c.passwd = response.SessionId, response.Passwd
+
+	// servers which predate read-only mode do not send the flag, in which case the connection is read-write
+	if readOnly, err := dec.ReadBoolean(); err == nil {
+		c.readOnly = readOnly
 	}
 
 	return nil
 }
 
+// readOnlyFlag follows the ConnectRequest and ConnectResponse records. It is not part of their jute definitions,
+// as it was added to the protocol later on.
+type readOnlyFlag bool
+
+// Write implements jute.RecordWriter.
+func (f readOnlyFlag) Write(enc jute.Encoder) error {
+	if err := enc.WriteStart(); err != nil {
+		return err
+	}
+	if err := enc.WriteBoolean(bool(f)); err != nil {
+		return err
+	}
+
+	return enc.WriteEnd()
+}
+
 // GetData calls Get on a Zookeeper server's node using the specified path and returns the server's response.
 func (c *Conn) GetData(path string) ([]byte, error) {
-	request := &proto.GetDataRequest{Path: path}
+	data, _, err := c.GetDataWithStat(path)
+	return data, err
+}
+
+// GetDataWithStat returns the data of the znode at the given path along with its Stat.
+// The version in the returned Stat can be used for a subsequent conditional SetData.
+func (c *Conn) GetDataWithStat(path string) ([]byte, *Stat, error) {
+	request := &proto.GetDataRequest{Path: c.serverPath(path)}
 	response := &proto.GetDataResponse{}
 
 	if err := c.rpc(opGetData, request, response); err != nil {
-		return nil, fmt.Errorf("error sending GetData request: %w", err)
+		return nil, nil, fmt.Errorf("error sending GetData request: %w", err)
+	}
+
+	return response.Data, statFromData(&response.Stat), nil
+}
+
+// Exists returns whether a znode exists at the given path, along with its Stat if it does.
+// A missing znode is not treated as an error.
+func (c *Conn) Exists(path string) (bool, *Stat, error) {
+	request := &proto.ExistsRequest{Path: c.serverPath(path)}
+	response := &proto.ExistsResponse{}
+
+	if err := c.rpc(opExists, request, response); err != nil {
+		if errors.Is(err, ErrNoNode) {
+			return false, nil, nil
+		}
+		return false, nil, fmt.Errorf("error sending Exists request: %w", err)
 	}
 
-	return response.Data, nil
+	return true, statFromData(&response.Stat), nil
+}
+
+// GetDataW returns the data of the znode at the given path along with its Stat, and sets a watch on the znode.
+// The returned channel receives a single event when the znode's data changes or the znode is deleted,
+// after which it is closed. It is closed without an event if the connection is closed first.
+func (c *Conn) GetDataW(path string) ([]byte, *Stat, <-chan Event, error) {
+	request := &proto.GetDataRequest{Path: c.serverPath(path), Watch: true}
+	response := &proto.GetDataResponse{}
+
+	watch := newWatchRegistration(path, watchKindData)
+	if err := c.rpcWithWatch(opGetData, request, response, watch); err != nil {
+		return nil, nil, nil, fmt.Errorf("error sending GetData request: %w", err)
+	}
+
+	return response.Data, statFromData(&response.Stat), watch.events, nil
+}
+
+// ExistsW returns whether a znode exists at the given path along with its Stat, and sets a watch on the path.
+// The watch is set even if the znode does not exist, in which case it is triggered once the znode is created.
+// The returned channel receives a single event and is then closed, as with GetDataW.
+func (c *Conn) ExistsW(path string) (bool, *Stat, <-chan Event, error) {
+	request := &proto.ExistsRequest{Path: c.serverPath(path), Watch: true}
+	response := &proto.ExistsResponse{}
+
+	watch := newWatchRegistration(path, watchKindData)
+	watch.exists = true
+	if err := c.rpcWithWatch(opExists, request, response, watch); err != nil {
+		if errors.Is(err, ErrNoNode) {
+			return false, nil, watch.events, nil
+		}
+		return false, nil, nil, fmt.Errorf("error sending Exists request: %w", err)
+	}
+
+	return true, statFromData(&response.Stat), watch.events, nil
+}
+
+// GetChildrenW returns all children of the znode at the given path along with its Stat, and sets a watch on the znode.
+// The returned channel receives a single event when a child is created or deleted, or when the znode itself is deleted,
+// after which it is closed.
+func (c *Conn) GetChildrenW(path string) ([]string, *Stat, <-chan Event, error) {
+	request := &proto.GetChildren2Request{Path: c.serverPath(path), Watch: true}
+	response := &proto.GetChildren2Response{}
+
+	watch := newWatchRegistration(path, watchKindChildren)
+	if err := c.rpcWithWatch(opGetChildren2, request, response, watch); err != nil {
+		return nil, nil, nil, fmt.Errorf("error sending GetChildren2 request: %w", err)
+	}
+
+	return response.Children, statFromData(&response.Stat), watch.events, nil
+}
+
+// AddWatch adds a watch on the given path which stays active until it is removed or the connection is closed.
+// Events are queued until they are received from the returned channel, which is closed once the watch is gone.
+// This call requires Zookeeper 3.6 or newer.
+func (c *Conn) AddWatch(path string, mode AddWatchMode) (<-chan Event, error) {
+	if mode != AddWatchModePersistent && mode != AddWatchModePersistentRecursive {
+		return nil, invalidArgsError("unsupported add watch mode %v", mode)
+	}
+	request := &proto.AddWatchRequest{Path: c.serverPath(path), Mode: int32(mode)}
+
+	kind := watchKindPersistent
+	if mode == AddWatchModePersistentRecursive {
+		kind = watchKindPersistentRecursive
+	}
+	watch := newWatchRegistration(path, kind)
+	// the server acknowledges AddWatch with an ErrorResponse which repeats the reply header's error code,
+	// so there is no reply record to decode
+	if err := c.rpcWithWatch(opAddWatch, request, nil, watch); err != nil {
+		return nil, fmt.Errorf("error sending AddWatch request: %w", err)
+	}
+
+	return watch.events, nil
+}
+
+// RemoveWatches removes the watches of the given type set on the path through this connection, both on the server
+// and client-side. Each removed watch receives an EventDataWatchRemoved, EventChildWatchRemoved or
+// EventPersistentWatchRemoved event, after which its channel is closed.
+// If local is true, the watches are removed client-side even if the server could not remove them,
+// for example because the server cannot be reached. ErrNoWatcher is returned if no matching watch is set.
+// This call requires Zookeeper 3.5 or newer.
+func (c *Conn) RemoveWatches(path string, watcherType WatcherType, local bool) error {
+	kinds := watcherType.kinds()
+	if kinds == nil {
+		return invalidArgsError("unsupported watcher type %v", watcherType)
+	}
+	if !c.watches.has(path, kinds) {
+		code := Error(errNoWatcher)
+		return fmt.Errorf("no %v watches set on %s: %w", watcherType, path, &code)
+	}
+
+	request := &proto.RemoveWatchesRequest{Path: c.serverPath(path), Type: int32(watcherType)}
+	if err := c.rpc(opRemoveWatches, request, nil); err != nil && !local {
+		return fmt.Errorf("error sending RemoveWatches request: %w", err)
+	}
+	c.watches.remove(path, kinds)
+
+	return nil
+}
+
+// CheckWatches checks whether watches of the given type set on the path through this connection are still present
+// on the server. ErrNoWatcher is returned if no matching watch is set. This call requires Zookeeper 3.5 or newer.
+func (c *Conn) CheckWatches(path string, watcherType WatcherType) error {
+	kinds := watcherType.kinds()
+	if kinds == nil {
+		return invalidArgsError("unsupported watcher type %v", watcherType)
+	}
+	if !c.watches.has(path, kinds) {
+		code := Error(errNoWatcher)
+		return fmt.Errorf("no %v watches set on %s: %w", watcherType, path, &code)
+	}
+
+	request := &proto.CheckWatchesRequest{Path: c.serverPath(path), Type: int32(watcherType)}
+	if err := c.rpc(opCheckWatches, request, nil); err != nil {
+		return fmt.Errorf("error sending CheckWatches request: %w", err)
+	}
+
+	return nil
 }
 
 // GetChildren returns all children of a node at the given path, if they exist.
 func (c *Conn) GetChildren(path string) ([]string, error) {
-	request := &proto.GetChildrenRequest{Path: path}
+	request := &proto.GetChildrenRequest{Path: c.serverPath(path)}
 	response := &proto.GetChildrenResponse{}
 
 	if err := c.rpc(opGetChildren, request, response); err != nil {
@@ -157,20 +436,339 @@ func (c *Conn) GetChildren(path string) ([]string, error) {
 	return response.Children, nil
 }
 
+// GetChildrenWithStat returns all children of a node at the given path along with the node's Stat.
+func (c *Conn) GetChildrenWithStat(path string) ([]string, *Stat, error) {
+	request := &proto.GetChildren2Request{Path: c.serverPath(path)}
+	response := &proto.GetChildren2Response{}
+
+	if err := c.rpc(opGetChildren2, request, response); err != nil {
+		return nil, nil, fmt.Errorf("error sending GetChildren2 request: %w", err)
+	}
+
+	return response.Children, statFromData(&response.Stat), nil
+}
+
+// GetEphemerals returns the paths of all ephemeral nodes created by the current session
+// whose path starts with the given prefix. This call requires Zookeeper 3.6 or newer.
+func (c *Conn) GetEphemerals(prefix string) ([]string, error) {
+	request := &proto.GetEphemeralsRequest{PrefixPath: c.serverPath(prefix)}
+	response := &proto.GetEphemeralsResponse{}
+
+	if err := c.rpc(opGetEphemerals, request, response); err != nil {
+		return nil, fmt.Errorf("error sending GetEphemerals request: %w", err)
+	}
+
+	ephemerals := make([]string, 0, len(response.Ephemerals))
+	for _, ephemeral := range response.Ephemerals {
+		// the prefix can also match siblings of the chroot, such as /app2 for the chroot /app
+		if c.inChroot(ephemeral) {
+			ephemerals = append(ephemerals, c.clientPath(ephemeral))
+		}
+	}
+
+	return ephemerals, nil
+}
+
+// GetAllChildrenNumber returns the number of all descendants of the node at the given path,
+// without having to list them. This call requires Zookeeper 3.6 or newer.
+func (c *Conn) GetAllChildrenNumber(path string) (int32, error) {
+	request := &proto.GetAllChildrenNumberRequest{Path: c.serverPath(path)}
+	response := &proto.GetAllChildrenNumberResponse{}
+
+	if err := c.rpc(opGetAllChildrenNumber, request, response); err != nil {
+		return 0, fmt.Errorf("error sending GetAllChildrenNumber request: %w", err)
+	}
+
+	return response.TotalNumber, nil
+}
+
+// Sync flushes the channel between the server the client is connected to and the leader for the given path.
+// Reads issued after Sync returns observe all changes committed before Sync was called.
+func (c *Conn) Sync(path string) (string, error) {
+	request := &proto.SyncRequest{Path: c.serverPath(path)}
+	response := &proto.SyncResponse{}
+
+	if err := c.rpc(opSync, request, response); err != nil {
+		return "", fmt.Errorf("error sending Sync request: %w", err)
+	}
+
+	return c.clientPath(response.Path), nil
+}
+
+// Create creates a znode at the given path with the specified data, create mode and ACL,
+// and returns the path of the created znode. When a sequential create mode is used,
+// the returned path contains the sequence number appended by the server.
+// Container and TTL nodes need to be created using Create2 and CreateTTL respectively.
+func (c *Conn) Create(path string, data []byte, flags CreateMode, acl []ACL) (string, error) {
+	if !flags.isClassic() {
+		return "", invalidArgsError("invalid create mode %v", flags)
+	}
+
+	request := &proto.CreateRequest{
+		Path:  c.serverPath(path),
+		Data:  data,
+		Acl:   toDataACL(acl),
+		Flags: int32(flags),
+	}
+	response := &proto.CreateResponse{}
+
+	if err := c.rpc(opCreate, request, response); err != nil {
+		return "", fmt.Errorf("error sending Create request: %w", err)
+	}
+
+	return c.clientPath(response.Path), nil
+}
+
+// Create2 creates a znode similarly to Create, additionally returning the Stat of the created znode.
+// Container nodes are supported by this call, while TTL nodes need to be created using CreateTTL.
+// This call requires Zookeeper 3.5 or newer.
+func (c *Conn) Create2(path string, data []byte, flags CreateMode, acl []ACL) (string, *Stat, error) {
+	if _, ok := createModeNames[flags]; !ok || flags.isTTL() {
+		return "", nil, invalidArgsError("invalid create mode %v", flags)
+	}
+
+	opcode := int32(opCreate2)
+	if flags == CreateModeContainer {
+		opcode = opCreateContainer
+	}
+
+	request := &proto.CreateRequest{
+		Path:  c.serverPath(path),
+		Data:  data,
+		Acl:   toDataACL(acl),
+		Flags: int32(flags),
+	}
+	response := &proto.Create2Response{}
+
+	if err := c.rpc(opcode, request, response); err != nil {
+		return "", nil, fmt.Errorf("error sending Create2 request: %w", err)
+	}
+
+	return c.clientPath(response.Path), statFromData(&response.Stat), nil
+}
+
+// CreateTTL creates a TTL znode, which the server deletes once it has not been modified within the given TTL
+// and has no children. Only the TTL create modes are accepted by this call.
+// The server returns errUnimpl if it is not configured with extended types enabled.
+func (c *Conn) CreateTTL(path string, data []byte, flags CreateMode, acl []ACL, ttl time.Duration) (string, *Stat, error) {
+	if !flags.isTTL() {
+		return "", nil, invalidArgsError("invalid create mode %v", flags)
+	}
+	if ttl < time.Millisecond || ttl > maxTTL {
+		return "", nil, invalidArgsError("invalid TTL %v", ttl)
+	}
+
+	request := &proto.CreateTTLRequest{
+		Path:  c.serverPath(path),
+		Data:  data,
+		Acl:   toDataACL(acl),
+		Flags: int32(flags),
+		Ttl:   ttl.Milliseconds(),
+	}
+	response := &proto.Create2Response{}
+
+	if err := c.rpc(opCreateTTL, request, response); err != nil {
+		return "", nil, fmt.Errorf("error sending CreateTTL request: %w", err)
+	}
+
+	return c.clientPath(response.Path), statFromData(&response.Stat), nil
+}
+
+// SetData sets the data of the znode at the given path if the znode's current version matches the given version,
+// returning the znode's updated Stat. If the versions do not match, ErrBadVersion is returned.
+func (c *Conn) SetData(path string, data []byte, version int32) (*Stat, error) {
+	request := &proto.SetDataRequest{
+		Path:    c.serverPath(path),
+		Data:    data,
+		Version: version,
+	}
+	response := &proto.SetDataResponse{}
+
+	if err := c.rpc(opSetData, request, response); err != nil {
+		return nil, fmt.Errorf("error sending SetData request: %w", err)
+	}
+
+	return statFromData(&response.Stat), nil
+}
+
+// Delete deletes the znode at the given path if the znode's current version matches the given version.
+// If the versions do not match, ErrBadVersion is returned.
+func (c *Conn) Delete(path string, version int32) error {
+	request := &proto.DeleteRequest{
+		Path:    c.serverPath(path),
+		Version: version,
+	}
+
+	if err := c.rpc(opDelete, request, nil); err != nil {
+		return fmt.Errorf("error sending Delete request: %w", err)
+	}
+
+	return nil
+}
+
+// GetACL returns the ACL of the znode at the given path along with its Stat.
+func (c *Conn) GetACL(path string) ([]ACL, *Stat, error) {
+	request := &proto.GetACLRequest{Path: c.serverPath(path)}
+	response := &proto.GetACLResponse{}
+
+	if err := c.rpc(opGetACL, request, response); err != nil {
+		return nil, nil, fmt.Errorf("error sending GetACL request: %w", err)
+	}
+
+	return fromDataACL(response.Acl), statFromData(&response.Stat), nil
+}
+
+// SetACL sets the ACL of the znode at the given path if the znode's current ACL version (Stat.Aversion)
+// matches the given version, returning the znode's updated Stat. If the versions do not match, ErrBadVersion is returned.
+func (c *Conn) SetACL(path string, acl []ACL, version int32) (*Stat, error) {
+	request := &proto.SetACLRequest{
+		Path:    c.serverPath(path),
+		Acl:     toDataACL(acl),
+		Version: version,
+	}
+	response := &proto.SetACLResponse{}
+
+	if err := c.rpc(opSetACL, request, response); err != nil {
+		return nil, fmt.Errorf("error sending SetACL request: %w", err)
+	}
+
+	return statFromData(&response.Stat), nil
+}
+
+// AddAuth adds the given authentication credentials to the session, for example the "digest" scheme
+// with "user:password" credentials. If the server rejects the credentials, it closes the connection.
+func (c *Conn) AddAuth(scheme string, auth []byte) error {
+	request := &proto.AuthPacket{
+		Scheme: scheme,
+		Auth:   auth,
+	}
+
+	c.authLock.Lock()
+	defer c.authLock.Unlock()
+
+	if err := c.rpcWithXid(authXID, opAuth, request, nil); err != nil {
+		return fmt.Errorf("error sending AddAuth request: %w", err)
+	}
+
+	return nil
+}
+
+// Multi executes the given operations atomically as a single transaction, returning the result of each operation.
+// If any operation fails, none of the operations are applied, and an error wrapping the failed operation's error is returned
+// along with the results, which contain a per-operation error. This call requires Zookeeper 3.4 or newer.
+func (c *Conn) Multi(ops ...Op) ([]OpResult, error) {
+	for _, op := range ops {
+		if create, ok := op.request.(*proto.CreateRequest); ok {
+			if flags := CreateMode(create.Flags); !flags.isClassic() {
+				return nil, invalidArgsError("invalid create mode %v for multi operation", flags)
+			}
+		}
+	}
+
+	request := &multiRequest{ops: make([]Op, len(ops))}
+	for i, op := range ops {
+		request.ops[i] = op.withPath(c.serverPath)
+	}
+	response := &multiResponse{}
+
+	if err := c.rpc(opMulti, request, response); err != nil {
+		return nil, fmt.Errorf("error sending Multi request: %w", err)
+	}
+	for i := range response.results {
+		if response.results[i].Path != "" {
+			response.results[i].Path = c.clientPath(response.results[i].Path)
+		}
+	}
+
+	for i, result := range response.results {
+		if result.Err != nil {
+			return response.results, fmt.Errorf("multi operation %d failed: %w", i, result.Err)
+		}
+	}
+
+	return response.results, nil
+}
+
+// GetConfig returns the current dynamic configuration of the ensemble. This call requires Zookeeper 3.5 or newer.
+// The config node is read regardless of the chroot, as it is not part of the client's namespace.
+func (c *Conn) GetConfig() (*EnsembleConfig, error) {
+	request := &proto.GetDataRequest{Path: configPath}
+	response := &proto.GetDataResponse{}
+
+	if err := c.rpc(opGetData, request, response); err != nil {
+		return nil, fmt.Errorf("error sending GetData request: %w", err)
+	}
+
+	return parseConfig(response.Data)
+}
+
+// Reconfig changes the membership of the ensemble and returns the resulting configuration.
+// An incremental reconfiguration adds the joining servers, given as "server.N=host:peer:election[:role][;clientaddr]",
+// and removes the leaving servers, given by their IDs. Alternatively, newMembers replaces the whole membership.
+// If fromConfig is not -1, the reconfiguration is only applied if the current config version matches it.
+// ErrReconfigDisabled is returned if the server has reconfiguration disabled, while ErrReconfigInProgress
+// is returned if another reconfiguration is currently in progress. This call requires Zookeeper 3.5 or newer.
+func (c *Conn) Reconfig(joining, leaving, newMembers []string, fromConfig int64) (*EnsembleConfig, error) {
+	request := &proto.ReconfigRequest{
+		JoiningServers: strings.Join(joining, ","),
+		LeavingServers: strings.Join(leaving, ","),
+		NewMembers:     strings.Join(newMembers, ","),
+		CurConfigId:    fromConfig,
+	}
+	response := &proto.GetDataResponse{}
+
+	if err := c.rpc(opReconfig, request, response); err != nil {
+		return nil, fmt.Errorf("error sending Reconfig request: %w", err)
+	}
+
+	return parseConfig(response.Data)
+}
+
+// WhoAmI returns the identities the current session is authenticated as, for example the "ip" identity
+// of the client and any identities added through AddAuth or TLS. This call requires Zookeeper 3.7 or newer.
+func (c *Conn) WhoAmI() ([]ClientInfo, error) {
+	response := &proto.WhoAmIResponse{}
+
+	if err := c.rpc(opWhoAmI, nil, response); err != nil {
+		return nil, fmt.Errorf("error sending WhoAmI request: %w", err)
+	}
+
+	clientInfo := make([]ClientInfo, len(response.ClientInfo))
+	for i, info := range response.ClientInfo {
+		clientInfo[i] = ClientInfo{AuthScheme: info.AuthScheme, User: info.User}
+	}
+
+	return clientInfo, nil
+}
+
 func (c *Conn) rpc(opcode int32, w jute.RecordWriter, r jute.RecordReader) error {
+	return c.rpcWithXid(c.nextXid(), opcode, w, r)
+}
+
+// rpcWithXid sends a request with the given xid, which is either a client-side request ID
+// or one of the special xids used by the Zookeeper protocol, and waits for the server's reply.
+func (c *Conn) rpcWithXid(xid, opcode int32, w jute.RecordWriter, r jute.RecordReader) error {
+	return c.send(xid, opcode, w, &pendingRequest{reply: r, done: make(chan struct{}, 1)})
+}
+
+// rpcWithWatch sends a request which sets a watch on the server, registering the watch once the server has replied.
+func (c *Conn) rpcWithWatch(opcode int32, w jute.RecordWriter, r jute.RecordReader, watch *watchRegistration) error {
+	return c.send(c.nextXid(), opcode, w, &pendingRequest{reply: r, done: make(chan struct{}, 1), watch: watch})
+}
+
+func (c *Conn) send(xid, opcode int32, w jute.RecordWriter, pending *pendingRequest) error {
 	header := &proto.RequestHeader{
-		Xid:  c.nextXid(),
+		Xid:  xid,
 		Type: opcode,
 	}
 
-	pending := &pendingRequest{
-		reply: r,
-		done:  make(chan struct{}, 1),
-	}
-
 	c.reqs.Store(header.Xid, pending)
 
-	if err := WriteRecords(c.conn, header, w); err != nil {
+	records := []jute.RecordWriter{header}
+	if w != nil {
+		records = append(records, w) // some requests, such as WhoAmI, consist of only a request header
+	}
+	if err := WriteRecords(c.conn, records...); err != nil {
 		return fmt.Errorf("could not write rpc request: %w", err)
 	}
 
@@ -185,13 +783,15 @@ func (c *Conn) rpc(opcode int32, w jute.RecordWriter, r jute.RecordReader) error
 }
 
 func (c *Conn) handleReads() {
-	defer c.Close()
+	var err error
+	defer func() { c.closeWithError(err) }()
 	for {
 		if c.sessionCtx.Err() != nil {
 			return
 		}
 
-		dec, err := createDecoder(c.conn)
+		var dec jute.Decoder
+		dec, err = createDecoder(c.conn)
 		if errors.Is(err, net.ErrClosed) || errors.Is(err, io.EOF) {
 			return // don't make further attempts to read from closed connection, close goroutine
 		}
@@ -205,9 +805,24 @@ func (c *Conn) handleReads() {
 			log.Printf("could not decode reply header: %v", err)
 			return
 		}
+		if replyHeader.Zxid > 0 {
+			c.updateZxid(replyHeader.Zxid)
+		}
 		if replyHeader.Xid == pingXID {
 			continue // ignore ping responses
 		}
+		if replyHeader.Xid == notificationXID {
+			event := &proto.WatcherEvent{}
+			if err = dec.ReadRecord(event); err != nil {
+				log.Printf("could not decode watch notification: %v", err)
+				return
+			}
+			c.watches.trigger(Event{Type: EventType(event.Type), Path: c.clientPath(event.Path)})
+			continue
+		}
+		if replyHeader.Xid == authXID && Error(replyHeader.Err) == errAuthFailed {
+			c.notifySession(SessionStateAuthFailed, Error(replyHeader.Err))
+		}
 
 		value, ok := c.reqs.LoadAndDelete(replyHeader.Xid)
 		if !ok {
@@ -216,12 +831,18 @@ func (c *Conn) handleReads() {
 		}
 
 		pending := value.(*pendingRequest)
+		if pending.watch != nil {
+			c.watches.register(pending.watch, Error(replyHeader.Err))
+		}
 		if replyHeader.Err != 0 {
 			code := Error(replyHeader.Err)
 			pending.error = &code
-		} else if err = dec.ReadRecord(pending.reply); err != nil {
-			log.Printf("could not decode reply record: %v", err)
-			return
+		} else if pending.reply != nil {
+			// reply is nil for requests which are acknowledged with only a reply header, such as Delete
+			if err = dec.ReadRecord(pending.reply); err != nil {
+				log.Printf("could not decode reply record: %v", err)
+				return
+			}
 		}
 
 		pending.done <- struct{}{}
@@ -233,7 +854,8 @@ func (c *Conn) keepAlive() {
 	pingTicker := time.NewTicker(c.sessionTimeout / 2)
 	defer pingTicker.Stop()
 
-	defer c.Close()
+	var err error
+	defer func() { c.closeWithError(err) }()
 	for {
 		select {
 		case <-pingTicker.C:
@@ -242,7 +864,7 @@ func (c *Conn) keepAlive() {
 				Type: opPing,
 			}
 
-			if err := WriteRecords(c.conn, header); err != nil {
+			if err = WriteRecords(c.conn, header); err != nil {
 				log.Printf("error writing ping request: %v", err)
 				return
 			}
@@ -252,6 +874,66 @@ func (c *Conn) keepAlive() {
 	}
 }
 
+// restoreWatches registers all tracked watches on the server. The server triggers the watches
+// for any change made after the last zxid seen, so that no change is missed while reconnecting.
+func (c *Conn) restoreWatches() error {
+	for _, request := range c.watches.setWatches(int64(c.LastZxid()), c.serverPath) {
+		// SetWatches2 is only supported since Zookeeper 3.6, so as with the Java client, SetWatches is sent
+		// instead unless persistent watches need to be restored, which older servers do not support anyway
+		if len(request.PersistentWatches) == 0 && len(request.PersistentRecursiveWatches) == 0 {
+			legacy := &proto.SetWatches{
+				RelativeZxid: request.RelativeZxid,
+				DataWatches:  request.DataWatches,
+				ExistWatches: request.ExistWatches,
+				ChildWatches: request.ChildWatches,
+			}
+			if err := c.rpcWithXid(setWatchesXID, opSetWatches, legacy, nil); err != nil {
+				return fmt.Errorf("error sending SetWatches request: %w", err)
+			}
+			continue
+		}
+
+		if err := c.rpcWithXid(setWatchesXID, opSetWatches2, request, nil); err != nil {
+			return fmt.Errorf("error sending SetWatches2 request: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// updateZxid records the zxid if it is higher than any zxid seen so far.
+func (c *Conn) updateZxid(zxid int64) {
+	for {
+		last := atomic.LoadInt64(&c.lastZxid)
+		if zxid <= last || atomic.CompareAndSwapInt64(&c.lastZxid, last, zxid) {
+			return
+		}
+	}
+}
+
+// LastZxid returns the highest zxid seen in the server's replies on this connection, or that of the session's
+// previous connections if it is resumed. When reconnecting, servers which have not caught up to it refuse the session,
+// so that clients never observe the state going back in time.
+func (c *Conn) LastZxid() Zxid {
+	return Zxid(atomic.LoadInt64(&c.lastZxid))
+}
+
+// Server returns the address of the server this connection is established with.
+func (c *Conn) Server() string {
+	return c.server
+}
+
+// IsReadOnly returns whether the connection is established with a read-only server, which rejects
+// write requests with ErrReadOnly.
+func (c *Conn) IsReadOnly() bool {
+	return c.readOnly
+}
+
+// SessionID returns the ID of the session established by this connection.
+func (c *Conn) SessionID() int64 {
+	return c.sessionID
+}
+
 func (c *Conn) clearPendingRequests() {
 	c.reqs.Range(func(key, value interface{}) bool {
 		c.reqs.Delete(key)
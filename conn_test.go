@@ -10,15 +10,22 @@ package zk
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"io"
 	"math"
 	"net"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/facebookincubator/zk/integration"
+	"github.com/facebookincubator/zk/internal/data"
+	"github.com/facebookincubator/zk/internal/proto"
+
+	"github.com/go-zookeeper/jute/lib/go/jute"
 )
 
 func TestAuthentication(t *testing.T) {
@@ -132,6 +139,41 @@ func TestGetChildrenDefault(t *testing.T) {
 	}
 }
 
+func TestCreateEphemeralSequential(t *testing.T) {
+	server, err := integration.NewZKServer("3.6.2", integration.DefaultConfig())
+	if err != nil {
+		t.Fatalf("unexpected error while initializing zk server: %v", err)
+	}
+	defer func(server *integration.ZKServer) {
+		if err = server.Shutdown(); err != nil {
+			t.Fatalf("unexpected error while shutting down zk server: %v", err)
+		}
+	}(server)
+	if err = server.Run(); err != nil {
+		t.Fatalf("unexpected error while calling RunZookeeperServer: %s", err)
+		return
+	}
+
+	conn, err := DialContext(context.Background(), "tcp", "127.0.0.1:2181")
+	if err != nil {
+		t.Fatalf("unexpected error dialing server: %v", err)
+	}
+	defer conn.Close()
+
+	first, err := conn.Create("/seq-", []byte("data"), CreateModeEphemeralSequential, OpenACLUnsafe)
+	if err != nil {
+		t.Fatalf("unexpected error calling Create: %v", err)
+	}
+	second, err := conn.Create("/seq-", []byte("data"), CreateModeEphemeralSequential, OpenACLUnsafe)
+	if err != nil {
+		t.Fatalf("unexpected error calling Create: %v", err)
+	}
+
+	if !strings.HasPrefix(first, "/seq-") || first >= second {
+		t.Fatalf("expected increasing sequential paths, got %s and %s", first, second)
+	}
+}
+
 func TestErrorCodeHandling(t *testing.T) {
 	server, err := integration.NewZKServer("3.6.2", integration.DefaultConfig())
 	if err != nil {
@@ -178,3 +220,607 @@ func TestNextXidOverflow(t *testing.T) {
 		t.Fatalf("expected nextXid not to overflow")
 	}
 }
+
+func TestStatEphemeralOwner(t *testing.T) {
+	tests := []struct {
+		owner     int64
+		ephemeral bool
+	}{
+		{owner: 0, ephemeral: false},
+		{owner: 0x1000000abcd, ephemeral: true},
+		{owner: containerEphemeralOwner, ephemeral: false},
+		{owner: extendedEphemeralMask | 1000, ephemeral: false}, // TTL node with a TTL of 1s
+	}
+
+	for _, test := range tests {
+		stat := &Stat{EphemeralOwner: test.owner}
+		if stat.IsEphemeral() != test.ephemeral {
+			t.Fatalf("expected IsEphemeral to be %v for owner %x", test.ephemeral, test.owner)
+		}
+	}
+}
+
+func TestZxid(t *testing.T) {
+	tests := []struct {
+		zxid    Zxid
+		epoch   int32
+		counter uint32
+	}{
+		{zxid: 0x110a7a8f37, epoch: 17, counter: 175804215}, // as reported by flw.Srvr
+		{zxid: 0x190000000, epoch: 1, counter: 0x90000000},
+		{zxid: 0x2ffffffff, epoch: 2, counter: 0xFFFFFFFF},
+	}
+	for _, test := range tests {
+		if test.zxid.Epoch() != test.epoch || test.zxid.Counter() != test.counter {
+			t.Fatalf("unexpected split of zxid 0x%x: epoch %d, counter %d", test.zxid, test.zxid.Epoch(), test.zxid.Counter())
+		}
+	}
+
+	conn := &Conn{}
+	conn.updateZxid(5)
+	conn.updateZxid(3)
+	if conn.LastZxid() != 5 {
+		t.Fatalf("expected the highest zxid seen to be kept, got %d", conn.LastZxid())
+	}
+}
+
+func TestDigestACL(t *testing.T) {
+	expected := []ACL{{
+		Perms: PermRead | PermWrite,
+		ID:    Id{Scheme: "digest", ID: "user:tpUq/4Pn5A64fVZyQ0gOJ8ZWqkY="},
+	}}
+
+	acl := DigestACL(PermRead|PermWrite, "user", "password")
+	if !reflect.DeepEqual(expected, acl) {
+		t.Fatalf("digestACL error: expected %+v, got %+v", expected, acl)
+	}
+	if perms := acl[0].Perms.String(); perms != "rw" {
+		t.Fatalf("expected perms to be formatted as \"rw\", got %q", perms)
+	}
+}
+
+// serverFunc is used by newTestConn to reply to a request with a list of records following the reply header.
+type serverFunc func(header *proto.RequestHeader, request jute.RecordReader) (Error, []jute.RecordWriter)
+
+// newTestConn returns a Conn which is connected through an in-memory pipe to a fake server.
+func newTestConn(t *testing.T, handler serverFunc) *Conn {
+	conn, _ := newTestConnWithServer(t, handler)
+	return conn
+}
+
+// newTestConnWithServer returns the server end of the connection as well, which tests can use to send notifications.
+func newTestConnWithServer(t *testing.T, handler serverFunc) (*Conn, net.Conn) {
+	client, server := net.Pipe()
+	sessionCtx, cancelSession := context.WithCancel(context.Background())
+	conn := &Conn{
+		conn:           client,
+		sessionTimeout: defaultTimeout,
+		sessionCtx:     sessionCtx,
+		cancelSession:  cancelSession,
+		watches:        newWatchManager(),
+	}
+
+	go func() {
+		defer server.Close()
+		for {
+			header, request, err := ReadRecord(server)
+			if err != nil {
+				return
+			}
+
+			code, records := handler(header, request)
+			reply := []jute.RecordWriter{&proto.ReplyHeader{Xid: header.Xid, Err: int32(code)}}
+			if err = WriteRecords(server, append(reply, records...)...); err != nil {
+				t.Errorf("fake server could not write reply: %v", err)
+				return
+			}
+		}
+	}()
+	go conn.handleReads()
+
+	return conn, server
+}
+
+func TestMulti(t *testing.T) {
+	conn := newTestConn(t, func(header *proto.RequestHeader, request jute.RecordReader) (Error, []jute.RecordWriter) {
+		multi, ok := request.(*multiRequest)
+		if !ok || len(multi.ops) != 3 {
+			return errMarshal, nil
+		}
+
+		if multi.ops[2].request.(*proto.CheckVersionRequest).Version == 1 {
+			return 0, []jute.RecordWriter{
+				&proto.MultiHeader{Type: opCreate},
+				&proto.CreateResponse{Path: "/config-0000000001"},
+				&proto.MultiHeader{Type: opSetData},
+				&proto.SetDataResponse{Stat: data.Stat{Version: 2}},
+				&proto.MultiHeader{Type: opCheck},
+				&proto.MultiHeader{Type: opError, Done: true, Err: -1},
+			}
+		}
+
+		// the check fails, so the preceding operations are rolled back
+		return 0, []jute.RecordWriter{
+			&proto.MultiHeader{Type: opError},
+			&proto.ErrorResponse{Err: 0},
+			&proto.MultiHeader{Type: opError},
+			&proto.ErrorResponse{Err: 0},
+			&proto.MultiHeader{Type: opError, Err: int32(errBadVersion)},
+			&proto.ErrorResponse{Err: int32(errBadVersion)},
+			&proto.MultiHeader{Type: opError, Done: true, Err: -1},
+		}
+	})
+	defer conn.Close()
+
+	ops := []Op{
+		CreateOp("/config-", []byte("new"), CreateModePersistentSequential, OpenACLUnsafe),
+		SetDataOp("/version", []byte("2"), 1),
+		CheckVersionOp("/lock", 1),
+	}
+	results, err := conn.Multi(ops...)
+	if err != nil {
+		t.Fatalf("unexpected error calling Multi: %v", err)
+	}
+	if len(results) != 3 || results[0].Path != "/config-0000000001" || results[1].Stat.Version != 2 {
+		t.Fatalf("multi error: unexpected results %+v", results)
+	}
+
+	ops[2] = CheckVersionOp("/lock", 0)
+	results, err = conn.Multi(ops...)
+	if !errors.Is(err, ErrBadVersion) {
+		t.Fatalf("expected error %v, got: %v", ErrBadVersion, err)
+	}
+	if len(results) != 3 || results[0].Err != nil || !errors.Is(results[2].Err, ErrBadVersion) {
+		t.Fatalf("multi error: unexpected results %+v", results)
+	}
+}
+
+func TestWhoAmI(t *testing.T) {
+	conn := newTestConn(t, func(header *proto.RequestHeader, request jute.RecordReader) (Error, []jute.RecordWriter) {
+		if header.Type != opWhoAmI || request != nil {
+			return errMarshal, nil
+		}
+
+		return 0, []jute.RecordWriter{&proto.WhoAmIResponse{ClientInfo: []data.ClientInfo{
+			{AuthScheme: "ip", User: "127.0.0.1"},
+			{AuthScheme: "digest", User: "user"},
+		}}}
+	})
+	defer conn.Close()
+
+	expected := []ClientInfo{{AuthScheme: "ip", User: "127.0.0.1"}, {AuthScheme: "digest", User: "user"}}
+	clientInfo, err := conn.WhoAmI()
+	if err != nil {
+		t.Fatalf("unexpected error calling WhoAmI: %v", err)
+	}
+	if !reflect.DeepEqual(expected, clientInfo) {
+		t.Fatalf("whoAmI error: expected %+v, got %+v", expected, clientInfo)
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	config := "server.1=10.0.0.1:2888:3888:participant;0.0.0.0:2181\n" +
+		"server.2=10.0.0.2:2888:3888:observer;2181\n" +
+		"server.3=[::1]:2888:3888\n" +
+		"version=10000000a"
+
+	expected := &EnsembleConfig{
+		Members: []EnsembleMember{
+			{ID: 1, Host: "10.0.0.1", PeerPort: 2888, ElectionPort: 3888, Role: "participant", ClientAddr: "0.0.0.0:2181"},
+			{ID: 2, Host: "10.0.0.2", PeerPort: 2888, ElectionPort: 3888, Role: "observer", ClientAddr: "0.0.0.0:2181"},
+			{ID: 3, Host: "::1", PeerPort: 2888, ElectionPort: 3888, Role: "participant"},
+		},
+		Version: 0x10000000a,
+	}
+
+	parsed, err := parseConfig([]byte(config))
+	if err != nil {
+		t.Fatalf("unexpected error parsing config: %v", err)
+	}
+	if !reflect.DeepEqual(expected, parsed) {
+		t.Fatalf("parseConfig error: expected %+v, got %+v", expected, parsed)
+	}
+	if member := parsed.Members[2].String(); member != "server.3=[::1]:2888:3888:participant" {
+		t.Fatalf("unexpected member format: %s", member)
+	}
+
+	if _, err = parseConfig([]byte("server.1=10.0.0.1:2888")); err == nil {
+		t.Fatalf("expected error parsing config line without election port")
+	}
+}
+
+func TestReconfigInProgress(t *testing.T) {
+	conn := newTestConn(t, func(header *proto.RequestHeader, request jute.RecordReader) (Error, []jute.RecordWriter) {
+		reconfig, ok := request.(*proto.ReconfigRequest)
+		if !ok || reconfig.JoiningServers != "server.4=10.0.0.4:2888:3888;2181" || reconfig.CurConfigId != -1 {
+			return errMarshal, nil
+		}
+
+		return errCfgInProgress, nil
+	})
+	defer conn.Close()
+
+	_, err := conn.Reconfig([]string{"server.4=10.0.0.4:2888:3888;2181"}, nil, nil, -1)
+	if !errors.Is(err, ErrReconfigInProgress) || errors.Is(err, ErrReconfigDisabled) {
+		t.Fatalf("expected error %v, got: %v", ErrReconfigInProgress, err)
+	}
+}
+
+func TestDigestMD5(t *testing.T) {
+	// test vectors from RFC 2831 section 4
+	digest := &digestMD5{
+		username:  "chris",
+		password:  "secret",
+		digestURI: "imap/elwood.innosoft.com",
+		cnonce:    "OA6MHXh6VqTrRk",
+	}
+	challenge := `realm="elwood.innosoft.com",nonce="OA6MG9tEQGm2hh",qop="auth",algorithm=md5-sess,charset=utf-8`
+
+	response, err := digest.respond([]byte(challenge))
+	if err != nil {
+		t.Fatalf("unexpected error responding to challenge: %v", err)
+	}
+	directives, err := parseDirectives(string(response))
+	if err != nil {
+		t.Fatalf("unexpected error parsing response: %v", err)
+	}
+	if directives["response"] != "d388dad90d4bbd760a152321f2143af7" || directives["realm"] != "elwood.innosoft.com" {
+		t.Fatalf("unexpected digest response: %s", response)
+	}
+
+	if err = digest.verify([]byte("rspauth=ea40f60335c427b5527b84dbabcdfffd")); err != nil {
+		t.Fatalf("unexpected error verifying rspauth: %v", err)
+	}
+	if err = digest.verify([]byte("rspauth=00000000000000000000000000000000")); err == nil {
+		t.Fatalf("expected error verifying invalid rspauth")
+	}
+}
+
+func TestAuthenticateSASL(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := &Conn{conn: client}
+
+	go func() {
+		defer server.Close()
+		challenge := `realm="zk-sasl-md5",nonce="nonce",qop="auth",charset=utf-8,algorithm=md5-sess`
+		for i := 0; i < 2; i++ {
+			header, request, err := ReadRecord(server)
+			if err != nil || header.Type != opSASL {
+				t.Errorf("fake server could not read SASL request: %v", err)
+				return
+			}
+
+			token := []byte(challenge)
+			if i == 1 {
+				directives, _ := parseDirectives(string(request.(*proto.GetSASLRequest).Token))
+				expected := &digestMD5{
+					username:  "super",
+					password:  "secret",
+					digestURI: "zookeeper/zk-sasl-md5",
+					realm:     "zk-sasl-md5",
+					nonce:     "nonce",
+					cnonce:    directives["cnonce"],
+				}
+				if directives["response"] != expected.digest("AUTHENTICATE:zookeeper/zk-sasl-md5") {
+					WriteRecords(server, &proto.ReplyHeader{Xid: header.Xid, Err: int32(errAuthFailed)})
+					return
+				}
+				token = []byte("rspauth=" + expected.digest(":zookeeper/zk-sasl-md5"))
+			}
+
+			reply := &proto.ReplyHeader{Xid: header.Xid}
+			if err = WriteRecords(server, reply, &proto.SetSASLResponse{Token: token}); err != nil {
+				t.Errorf("fake server could not write SASL response: %v", err)
+				return
+			}
+		}
+	}()
+
+	if err := conn.authenticateSASL(&SASLConfig{Username: "super", Password: "secret"}); err != nil {
+		t.Fatalf("unexpected error during SASL handshake: %v", err)
+	}
+}
+
+func TestWatches(t *testing.T) {
+	conn, server := newTestConnWithServer(t, func(header *proto.RequestHeader, request jute.RecordReader) (Error, []jute.RecordWriter) {
+		switch r := request.(type) {
+		case *proto.GetDataRequest:
+			if r.Watch {
+				return 0, []jute.RecordWriter{&proto.GetDataResponse{Data: []byte("data")}}
+			}
+		case *proto.ExistsRequest:
+			if r.Watch {
+				return errNoNode, nil
+			}
+		case *proto.GetChildren2Request:
+			if r.Watch {
+				return 0, []jute.RecordWriter{&proto.GetChildren2Response{Children: []string{"child"}}}
+			}
+		}
+
+		return errMarshal, nil
+	})
+	defer conn.Close()
+
+	data, _, dataEvents, err := conn.GetDataW("/data")
+	if err != nil || string(data) != "data" {
+		t.Fatalf("unexpected GetDataW result %q: %v", data, err)
+	}
+	exists, _, existsEvents, err := conn.ExistsW("/missing")
+	if err != nil || exists {
+		t.Fatalf("unexpected ExistsW result %v: %v", exists, err)
+	}
+	_, _, childEvents, err := conn.GetChildrenW("/data")
+	if err != nil {
+		t.Fatalf("unexpected error calling GetChildrenW: %v", err)
+	}
+
+	notify := func(eventType EventType, path string) {
+		header := &proto.ReplyHeader{Xid: notificationXID}
+		if err := WriteRecords(server, header, &proto.WatcherEvent{Type: int32(eventType), Path: path}); err != nil {
+			t.Fatalf("fake server could not write notification: %v", err)
+		}
+	}
+	notify(EventNodeCreated, "/missing")
+	notify(EventNodeDataChanged, "/data")
+	// one-shot watches have already been removed, so this notification is not delivered
+	notify(EventNodeDataChanged, "/data")
+
+	expected := []Event{{Type: EventNodeCreated, Path: "/missing"}, {Type: EventNodeDataChanged, Path: "/data"}}
+	for i, events := range []<-chan Event{existsEvents, dataEvents} {
+		if event := <-events; event != expected[i] {
+			t.Fatalf("watch error: expected event %+v, got %+v", expected[i], event)
+		}
+		if _, ok := <-events; ok {
+			t.Fatalf("expected watch channel to be closed after the event")
+		}
+	}
+
+	conn.Close()
+	if _, ok := <-childEvents; ok {
+		t.Fatalf("expected untriggered watch channel to be closed with the connection")
+	}
+}
+
+func TestAddWatch(t *testing.T) {
+	conn, server := newTestConnWithServer(t, func(header *proto.RequestHeader, request jute.RecordReader) (Error, []jute.RecordWriter) {
+		if _, ok := request.(*proto.AddWatchRequest); ok && header.Type == opAddWatch {
+			return 0, nil
+		}
+
+		return errMarshal, nil
+	})
+	defer conn.Close()
+
+	recursiveEvents, err := conn.AddWatch("/config", AddWatchModePersistentRecursive)
+	if err != nil {
+		t.Fatalf("unexpected error calling AddWatch: %v", err)
+	}
+	persistentEvents, err := conn.AddWatch("/config", AddWatchModePersistent)
+	if err != nil {
+		t.Fatalf("unexpected error calling AddWatch: %v", err)
+	}
+
+	notifications := []Event{
+		{Type: EventNodeCreated, Path: "/config/service/host"},
+		{Type: EventNodeChildrenChanged, Path: "/config"},
+		{Type: EventNodeDataChanged, Path: "/config"},
+		{Type: EventNodeDataChanged, Path: "/configuration"},
+	}
+	for _, event := range notifications {
+		header := &proto.ReplyHeader{Xid: notificationXID}
+		if err = WriteRecords(server, header, &proto.WatcherEvent{Type: int32(event.Type), Path: event.Path}); err != nil {
+			t.Fatalf("fake server could not write notification: %v", err)
+		}
+	}
+	if event := <-persistentEvents; event != notifications[1] {
+		t.Fatalf("persistent watch error: expected event %+v, got %+v", notifications[1], event)
+	}
+	if event := <-persistentEvents; event != notifications[2] {
+		t.Fatalf("persistent watch error: expected event %+v, got %+v", notifications[2], event)
+	}
+	// the reply to this request is read after all notifications, so they have been delivered once it returns
+	if _, err = conn.Sync("/"); !errors.Is(err, Error(errMarshal)) {
+		t.Fatalf("expected error %v, got: %v", errMarshal, err)
+	}
+	conn.Close()
+
+	var received []Event
+	for event := range recursiveEvents {
+		received = append(received, event)
+	}
+	if expected := []Event{notifications[0], notifications[2]}; !reflect.DeepEqual(expected, received) {
+		t.Fatalf("recursive watch error: expected events %+v, got %+v", expected, received)
+	}
+	if _, ok := <-persistentEvents; ok {
+		t.Fatalf("expected persistent watch channel to be closed with the connection")
+	}
+}
+
+func TestRemoveWatches(t *testing.T) {
+	conn := newTestConn(t, func(header *proto.RequestHeader, request jute.RecordReader) (Error, []jute.RecordWriter) {
+		switch r := request.(type) {
+		case *proto.GetDataRequest:
+			return 0, []jute.RecordWriter{&proto.GetDataResponse{}}
+		case *proto.GetChildren2Request:
+			return 0, []jute.RecordWriter{&proto.GetChildren2Response{}}
+		case *proto.AddWatchRequest:
+			return 0, nil
+		case *proto.CheckWatchesRequest:
+			return 0, nil
+		case *proto.RemoveWatchesRequest:
+			if r.Path == "/data" && WatcherType(r.Type) == WatcherTypeAny {
+				return 0, nil
+			}
+			return errNoWatcher, nil // the server has lost track of all other watches
+		}
+
+		return errMarshal, nil
+	})
+	defer conn.Close()
+
+	_, _, dataEvents, err := conn.GetDataW("/data")
+	if err != nil {
+		t.Fatalf("unexpected error calling GetDataW: %v", err)
+	}
+	persistentEvents, err := conn.AddWatch("/data", AddWatchModePersistent)
+	if err != nil {
+		t.Fatalf("unexpected error calling AddWatch: %v", err)
+	}
+	_, _, childEvents, err := conn.GetChildrenW("/children")
+	if err != nil {
+		t.Fatalf("unexpected error calling GetChildrenW: %v", err)
+	}
+
+	if err = conn.CheckWatches("/data", WatcherTypeData); err != nil {
+		t.Fatalf("unexpected error calling CheckWatches: %v", err)
+	}
+	if err = conn.CheckWatches("/data", WatcherTypeChildren); !errors.Is(err, ErrNoWatcher) {
+		t.Fatalf("expected error %v, got: %v", ErrNoWatcher, err)
+	}
+
+	if err = conn.RemoveWatches("/data", WatcherTypeAny, false); err != nil {
+		t.Fatalf("unexpected error calling RemoveWatches: %v", err)
+	}
+	removed := map[<-chan Event]Event{
+		dataEvents:       {Type: EventDataWatchRemoved, Path: "/data"},
+		persistentEvents: {Type: EventPersistentWatchRemoved, Path: "/data"},
+	}
+	for events, expected := range removed {
+		if event := <-events; event != expected {
+			t.Fatalf("remove watches error: expected event %+v, got %+v", expected, event)
+		}
+		if _, ok := <-events; ok {
+			t.Fatalf("expected removed watch channel to be closed")
+		}
+	}
+
+	if err = conn.RemoveWatches("/children", WatcherTypeChildren, false); !errors.Is(err, ErrNoWatcher) {
+		t.Fatalf("expected error %v, got: %v", ErrNoWatcher, err)
+	}
+	if err = conn.RemoveWatches("/children", WatcherTypeChildren, true); err != nil {
+		t.Fatalf("unexpected error calling RemoveWatches locally: %v", err)
+	}
+	if event := <-childEvents; event.Type != EventChildWatchRemoved {
+		t.Fatalf("remove watches error: expected %v event, got %+v", EventChildWatchRemoved, event)
+	}
+}
+
+func TestParseEnsemble(t *testing.T) {
+	hosts, err := parseEnsemble(" 10.0.0.1:2181, zk2 ,[::1]:2182,::2,")
+	if err != nil {
+		t.Fatalf("unexpected error parsing ensemble: %v", err)
+	}
+
+	sort.Strings(hosts)
+	expected := []string{"10.0.0.1:2181", "[::1]:2182", "[::2]:2181", "zk2:2181"}
+	if !reflect.DeepEqual(expected, hosts) {
+		t.Fatalf("parseEnsemble error: expected %v, got %v", expected, hosts)
+	}
+
+	if _, err = parseEnsemble(" , "); err == nil {
+		t.Fatalf("expected error parsing ensemble without hosts")
+	}
+}
+
+func TestChroot(t *testing.T) {
+	conn, server := newTestConnWithServer(t, func(header *proto.RequestHeader, request jute.RecordReader) (Error, []jute.RecordWriter) {
+		switch r := request.(type) {
+		case *proto.CreateRequest:
+			if r.Path == "/app/node-" {
+				return 0, []jute.RecordWriter{&proto.CreateResponse{Path: "/app/node-0000000001"}}
+			}
+		case *proto.GetDataRequest:
+			if r.Path == "/app/data" && r.Watch {
+				return 0, []jute.RecordWriter{&proto.GetDataResponse{}}
+			}
+		case *proto.SyncRequest:
+			if r.Path == "/app" {
+				return 0, []jute.RecordWriter{&proto.SyncResponse{Path: "/app"}}
+			}
+		case *proto.GetEphemeralsRequest:
+			if r.PrefixPath == "/app" {
+				return 0, []jute.RecordWriter{&proto.GetEphemeralsResponse{Ephemerals: []string{"/app/e", "/app2/e"}}}
+			}
+		case *multiRequest:
+			if r.ops[0].request.(*proto.CreateRequest).Path == "/app/a" {
+				return 0, []jute.RecordWriter{
+					&proto.MultiHeader{Type: opCreate},
+					&proto.CreateResponse{Path: "/app/a"},
+					&proto.MultiHeader{Type: opError, Done: true, Err: -1},
+				}
+			}
+		}
+
+		return errMarshal, nil
+	})
+	defer conn.Close()
+	conn.chroot = "/app"
+
+	if path, err := conn.Create("/node-", nil, CreateModePersistentSequential, OpenACLUnsafe); err != nil || path != "/node-0000000001" {
+		t.Fatalf("unexpected Create result %q: %v", path, err)
+	}
+	if path, err := conn.Sync("/"); err != nil || path != "/" {
+		t.Fatalf("unexpected Sync result %q: %v", path, err)
+	}
+	ephemerals, err := conn.GetEphemerals("/")
+	if err != nil || !reflect.DeepEqual(ephemerals, []string{"/e"}) {
+		t.Fatalf("unexpected GetEphemerals result %v: %v", ephemerals, err)
+	}
+
+	op := CreateOp("/a", nil, CreateModePersistent, OpenACLUnsafe)
+	results, err := conn.Multi(op)
+	if err != nil || results[0].Path != "/a" {
+		t.Fatalf("unexpected Multi result %+v: %v", results, err)
+	}
+	if path := op.request.(*proto.CreateRequest).Path; path != "/a" {
+		t.Fatalf("expected the caller's operation to be left unchanged, got path %s", path)
+	}
+
+	_, _, events, err := conn.GetDataW("/data")
+	if err != nil {
+		t.Fatalf("unexpected error calling GetDataW: %v", err)
+	}
+	header := &proto.ReplyHeader{Xid: notificationXID}
+	if err = WriteRecords(server, header, &proto.WatcherEvent{Type: int32(EventNodeDeleted), Path: "/app/data"}); err != nil {
+		t.Fatalf("fake server could not write notification: %v", err)
+	}
+	if event := <-events; event.Path != "/data" {
+		t.Fatalf("expected chroot to be stripped from event path, got %+v", event)
+	}
+}
+
+// trackedConn records whether the connection was closed.
+type trackedConn struct {
+	net.Conn
+	closed chan struct{}
+}
+
+func (c *trackedConn) Close() error {
+	close(c.closed)
+	return c.Conn.Close()
+}
+
+func TestIsReadWriteClosesConnOnTLSFailure(t *testing.T) {
+	conn := &trackedConn{closed: make(chan struct{})}
+	client := &Client{
+		Network:   "tcp",
+		TLSConfig: &tls.Config{},
+		Dialer: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var server net.Conn
+			conn.Conn, server = net.Pipe()
+			server.Close() // fail the handshake
+			return conn, nil
+		},
+	}
+
+	if client.isReadWrite(context.Background(), "127.0.0.1:2181", time.Second) {
+		t.Fatalf("expected the probe to fail")
+	}
+	select {
+	case <-conn.closed:
+	default:
+		t.Fatalf("expected the connection to be closed after the TLS handshake failed")
+	}
+}
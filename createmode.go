@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package zk
+
+import (
+	"fmt"
+	"time"
+)
+
+// maxTTL is the largest TTL supported by the server, as TTLs are stored in the lower 40 bits of the ephemeral owner.
+const maxTTL = time.Duration(0xFFFFFFFFFF) * time.Millisecond
+
+// CreateMode determines how a znode is created on the Zookeeper server.
+// ref: https://zookeeper.apache.org/doc/current/apidocs/zookeeper-server/org/apache/zookeeper/CreateMode.html
+type CreateMode int32
+
+// These constants represent the create modes supported by the Zookeeper server.
+// Ephemeral nodes are deleted when the session which created them ends, while
+// sequential nodes have a monotonically increasing counter appended to their name.
+const (
+	CreateModePersistent CreateMode = iota
+	CreateModeEphemeral
+	CreateModePersistentSequential
+	CreateModeEphemeralSequential
+	// CreateModeContainer nodes are deleted by the server once their last child is removed.
+	CreateModeContainer
+	// CreateModePersistentWithTTL and CreateModePersistentSequentialWithTTL nodes are deleted
+	// by the server if they have not been modified within their TTL and have no children.
+	// TTL nodes require the server to run with extended types enabled.
+	CreateModePersistentWithTTL
+	CreateModePersistentSequentialWithTTL
+)
+
+var createModeNames = map[CreateMode]string{
+	CreateModePersistent:           "persistent",
+	CreateModeEphemeral:            "ephemeral",
+	CreateModePersistentSequential: "persistent-sequential",
+	CreateModeEphemeralSequential:  "ephemeral-sequential",
+	CreateModeContainer:            "container",
+
+	CreateModePersistentWithTTL:           "persistent-with-ttl",
+	CreateModePersistentSequentialWithTTL: "persistent-sequential-with-ttl",
+}
+
+func (m CreateMode) String() string {
+	if name, ok := createModeNames[m]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("unknown create mode: %d", int32(m))
+}
+
+// isClassic returns true for the create modes which are supported by opCreate.
+func (m CreateMode) isClassic() bool {
+	return m >= CreateModePersistent && m <= CreateModeEphemeralSequential
+}
+
+func (m CreateMode) isTTL() bool {
+	return m == CreateModePersistentWithTTL || m == CreateModePersistentSequentialWithTTL
+}
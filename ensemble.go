@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package zk
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+)
+
+// defaultPort is the client port used for ensemble hosts which do not specify one.
+const defaultPort = "2181"
+
+// isTCPNetwork returns whether the network's addresses are host:port pairs, which can be listed in a connect string.
+func isTCPNetwork(network string) bool {
+	return strings.HasPrefix(network, "tcp")
+}
+
+// parseEnsemble splits a connect string of comma-separated host:port pairs, such as "host1:2181,host2:2181",
+// into its hosts. The hosts are shuffled so that clients using the same connect string are spread across the ensemble.
+func parseEnsemble(ensemble string) ([]string, error) {
+	var hosts []string
+	for _, host := range strings.Split(ensemble, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(strings.Trim(host, "[]"), defaultPort)
+		}
+		hosts = append(hosts, host)
+	}
+	if len(hosts) == 0 {
+		return nil, errors.New("no hosts found in ensemble connect string")
+	}
+
+	// a seeded source is used, since the global source is deterministic unless seeded by the application
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	rnd.Shuffle(len(hosts), func(i, j int) {
+		hosts[i], hosts[j] = hosts[j], hosts[i]
+	})
+
+	return hosts, nil
+}
@@ -21,6 +21,19 @@ func (e Error) Error() string {
 	return fmt.Sprintf("unknown error code: %d", e)
 }
 
+// Is allows server-side errors to be matched against the exported error codes using errors.Is.
+func (e *Error) Is(target error) bool {
+	code, ok := target.(Error)
+	return ok && *e == code
+}
+
+// invalidArgsError is returned for requests which are rejected client-side before being sent.
+// It wraps errArgs the same way server-side errors are surfaced, so that clients do not retry them.
+func invalidArgsError(format string, a ...interface{}) error {
+	code := Error(errArgs)
+	return fmt.Errorf("%s: %w", fmt.Sprintf(format, a...), &code)
+}
+
 // ref: https://github.com/apache/zookeeper/blob/master/zookeeper-client/zookeeper-client-c/include/zookeeper.h#L94
 const (
 	// System and server-side errors
@@ -60,6 +73,26 @@ const (
 	errThrottled  Error = -127
 )
 
+// Exported error codes which callers can match against using errors.Is.
+const (
+	ErrNoNode     = errNoNode
+	ErrBadVersion = errBadVersion
+	ErrNodeExists = errNodeExists
+	ErrNotEmpty   = errNotEmpty
+	// ErrSessionExpired is returned when a session cannot be resumed because the server has expired it.
+	ErrSessionExpired = errExpired
+	// ErrReadOnly is returned for write requests sent to a read-only server.
+	ErrReadOnly = errReadOnly
+	// ErrAuthFailed is returned when the server rejects credentials, such as those passed to AddAuth.
+	ErrAuthFailed = errAuthFailed
+	// ErrNoWatcher is returned by RemoveWatches and CheckWatches if no matching watch is set on the path.
+	ErrNoWatcher = errNoWatcher
+
+	ErrReconfigDisabled   = errReconfig
+	ErrReconfigInProgress = Error(errCfgInProgress)
+	ErrNewConfigNoQuorum  = Error(errQuorum)
+)
+
 var errToString = map[Error]string{
 	errSys:           "system error",
 	errRuntime:       "runtime inconsistency found",
@@ -0,0 +1,201 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package zk
+
+import (
+	"fmt"
+
+	"github.com/facebookincubator/zk/internal/proto"
+
+	"github.com/go-zookeeper/jute/lib/go/jute"
+)
+
+// Op is a single operation which is executed as part of a multi transaction, see Conn.Multi.
+type Op struct {
+	opcode  int32
+	request jute.RecordWriter
+}
+
+// CreateOp returns an operation which creates a znode, similarly to Conn.Create.
+func CreateOp(path string, data []byte, flags CreateMode, acl []ACL) Op {
+	return Op{
+		opcode: opCreate,
+		request: &proto.CreateRequest{
+			Path:  path,
+			Data:  data,
+			Acl:   toDataACL(acl),
+			Flags: int32(flags),
+		},
+	}
+}
+
+// DeleteOp returns an operation which deletes a znode, similarly to Conn.Delete.
+func DeleteOp(path string, version int32) Op {
+	return Op{
+		opcode:  opDelete,
+		request: &proto.DeleteRequest{Path: path, Version: version},
+	}
+}
+
+// SetDataOp returns an operation which sets the data of a znode, similarly to Conn.SetData.
+func SetDataOp(path string, data []byte, version int32) Op {
+	return Op{
+		opcode:  opSetData,
+		request: &proto.SetDataRequest{Path: path, Data: data, Version: version},
+	}
+}
+
+// CheckVersionOp returns an operation which fails the transaction
+// unless the znode at the given path has the given version.
+func CheckVersionOp(path string, version int32) Op {
+	return Op{
+		opcode:  opCheck,
+		request: &proto.CheckVersionRequest{Path: path, Version: version},
+	}
+}
+
+// withPath returns a copy of the operation with its path mapped by the given function,
+// which is used to apply the connection's chroot without modifying the caller's operation.
+func (op Op) withPath(mapPath func(string) string) Op {
+	switch r := op.request.(type) {
+	case *proto.CreateRequest:
+		request := *r
+		request.Path = mapPath(r.Path)
+		op.request = &request
+	case *proto.DeleteRequest:
+		request := *r
+		request.Path = mapPath(r.Path)
+		op.request = &request
+	case *proto.SetDataRequest:
+		request := *r
+		request.Path = mapPath(r.Path)
+		op.request = &request
+	case *proto.CheckVersionRequest:
+		request := *r
+		request.Path = mapPath(r.Path)
+		op.request = &request
+	}
+
+	return op
+}
+
+// OpResult is the result of a single operation of a multi transaction.
+type OpResult struct {
+	// Path is the path of the created znode, set for operations created with CreateOp.
+	Path string
+	// Stat is the updated Stat of the znode, set for operations created with SetDataOp.
+	Stat *Stat
+	// Err is set if the transaction failed, in which case none of the operations have been applied.
+	// The operation which caused the failure carries its server-side error, while the operations
+	// following it carry a runtime inconsistency error as they have not been attempted.
+	Err error
+}
+
+// multiRequest is the record sent for opMulti, made up of a MultiHeader followed by the request of each operation.
+// The operations are terminated by a MultiHeader which is marked as done.
+type multiRequest struct {
+	ops []Op
+}
+
+func (r *multiRequest) Write(enc jute.Encoder) error {
+	for _, op := range r.ops {
+		if err := enc.WriteRecord(&proto.MultiHeader{Type: op.opcode, Done: false, Err: -1}); err != nil {
+			return err
+		}
+		if err := enc.WriteRecord(op.request); err != nil {
+			return err
+		}
+	}
+
+	return enc.WriteRecord(&proto.MultiHeader{Type: opError, Done: true, Err: -1})
+}
+
+func (r *multiRequest) Read(dec jute.Decoder) error {
+	for {
+		header := &proto.MultiHeader{}
+		if err := dec.ReadRecord(header); err != nil {
+			return err
+		}
+		if header.Done {
+			return nil
+		}
+
+		var request interface {
+			jute.RecordReader
+			jute.RecordWriter
+		}
+		switch header.Type {
+		case opCreate:
+			request = &proto.CreateRequest{}
+		case opDelete:
+			request = &proto.DeleteRequest{}
+		case opSetData:
+			request = &proto.SetDataRequest{}
+		case opCheck:
+			request = &proto.CheckVersionRequest{}
+		default:
+			return fmt.Errorf("unrecognized multi operation type: %d", header.Type)
+		}
+
+		if err := dec.ReadRecord(request); err != nil {
+			return err
+		}
+		r.ops = append(r.ops, Op{opcode: header.Type, request: request})
+	}
+}
+
+// multiResponse is the record received for opMulti, made up of a MultiHeader followed by the result of each operation.
+// Failed transactions contain an error result for every operation.
+type multiResponse struct {
+	results []OpResult
+}
+
+func (r *multiResponse) Read(dec jute.Decoder) error {
+	for {
+		header := &proto.MultiHeader{}
+		if err := dec.ReadRecord(header); err != nil {
+			return err
+		}
+		if header.Done {
+			return nil
+		}
+
+		result := OpResult{}
+		switch header.Type {
+		case opCreate:
+			response := &proto.CreateResponse{}
+			if err := dec.ReadRecord(response); err != nil {
+				return err
+			}
+			result.Path = response.Path
+		case opSetData:
+			response := &proto.SetDataResponse{}
+			if err := dec.ReadRecord(response); err != nil {
+				return err
+			}
+			result.Stat = statFromData(&response.Stat)
+		case opDelete, opCheck:
+			// these operations have no result body
+		case opError:
+			response := &proto.ErrorResponse{}
+			if err := dec.ReadRecord(response); err != nil {
+				return err
+			}
+			// operations preceding the failed one are reported with a zero error code
+			if response.Err != 0 {
+				code := Error(response.Err)
+				result.Err = &code
+			}
+		default:
+			return fmt.Errorf("unrecognized multi result type: %d", header.Type)
+		}
+
+		r.results = append(r.results, result)
+	}
+}
@@ -8,13 +8,50 @@
 
 package zk
 
-// pingXID represents the XID which is used in ping/keepalive packet headers.
-const pingXID = -2
+// Below constants represent the special XIDs used by requests which are not matched by a client-side request ID.
+const (
+	// notificationXID represents the XID which is used by watch notifications sent by the server.
+	notificationXID = -1
+	// pingXID represents the XID which is used in ping/keepalive packet headers.
+	pingXID = -2
+	// authXID represents the XID which is used by authentication packets sent through AddAuth.
+	authXID = -4
+	// setWatchesXID represents the XID which is used by requests restoring watches on a new connection.
+	setWatchesXID = -8
+)
 
 // Below constants represent codes used by Zookeeper to differentiate requests.
 // https://zookeeper.apache.org/doc/r3.4.8/api/constant-values.html#org.apache.zookeeper.ZooDefs.OpCode.getData
 const (
-	opGetData     = 4
-	opGetChildren = 8
-	opPing        = 11
+	opCreate       = 1
+	opDelete       = 2
+	opExists       = 3
+	opGetData      = 4
+	opSetData      = 5
+	opGetACL       = 6
+	opSetACL       = 7
+	opGetChildren  = 8
+	opSync         = 9
+	opPing         = 11
+	opGetChildren2 = 12
+	opCheck        = 13
+	opMulti        = 14
+
+	opCreate2         = 15
+	opReconfig        = 16
+	opCheckWatches    = 17
+	opRemoveWatches   = 18
+	opCreateContainer = 19
+	opCreateTTL       = 21
+
+	opAuth                 = 100
+	opSetWatches           = 101
+	opSASL                 = 102
+	opGetEphemerals        = 103
+	opGetAllChildrenNumber = 104
+	opSetWatches2          = 105
+	opAddWatch             = 106
+	opWhoAmI               = 107
+	// opError is the type used in multi transactions to mark failed operations and the end of the transaction
+	opError = -1
 )
@@ -0,0 +1,194 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package zk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Quotas are stored by the server under /zookeeper/quota, mirroring the path of the subtree they apply to.
+// ref: https://zookeeper.apache.org/doc/current/zookeeperQuotas.html
+const (
+	quotaPath       = "/zookeeper/quota"
+	quotaLimitsNode = "zookeeper_limits"
+	quotaStatsNode  = "zookeeper_stats"
+)
+
+// Quota represents the limits or usage of a subtree, stored in the "count=..,bytes=.." format used by the server.
+// A value of -1 means that the corresponding limit is not set, while hard limits are also considered unset when zero.
+// Hard limits are only enforced by Zookeeper 3.7 or newer, while exceeding the other limits only causes
+// the server to log a warning.
+type Quota struct {
+	Count          int64 // number of znodes in the subtree, including its root
+	Bytes          int64 // total size of the data of the znodes in the subtree
+	CountHardLimit int64
+	BytesHardLimit int64
+}
+
+// String formats the quota the same way the server does, omitting hard limits which are not set.
+func (q *Quota) String() string {
+	quota := fmt.Sprintf("count=%d,bytes=%d", q.Count, q.Bytes)
+	if q.CountHardLimit > 0 {
+		quota += fmt.Sprintf(",countHardLimit=%d", q.CountHardLimit)
+	}
+	if q.BytesHardLimit > 0 {
+		quota += fmt.Sprintf(",byteHardLimit=%d", q.BytesHardLimit)
+	}
+
+	return quota
+}
+
+// parseQuota parses the contents of a zookeeper_limits or zookeeper_stats node.
+func parseQuota(data []byte) (*Quota, error) {
+	quota := &Quota{Count: -1, Bytes: -1, CountHardLimit: -1, BytesHardLimit: -1}
+	for _, field := range strings.Split(strings.TrimSpace(string(data)), ",") {
+		idx := strings.Index(field, "=")
+		if idx == -1 {
+			return nil, fmt.Errorf("invalid quota field %q", field)
+		}
+
+		value, err := strconv.ParseInt(field[idx+1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quota field %q: %w", field, err)
+		}
+
+		switch field[:idx] {
+		case "count":
+			quota.Count = value
+		case "bytes":
+			quota.Bytes = value
+		case "countHardLimit":
+			quota.CountHardLimit = value
+		case "byteHardLimit":
+			quota.BytesHardLimit = value
+		}
+	}
+
+	return quota, nil
+}
+
+// SetQuota sets the quota of the subtree at the given path, creating the quota nodes if they do not exist yet.
+// This is equivalent to the setquota command of the Zookeeper CLI.
+func (client *Client) SetQuota(ctx context.Context, path string, limits Quota) error {
+	if err := client.validateQuotaPath(path); err != nil {
+		return err
+	}
+
+	exists, _, err := client.Exists(ctx, path)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("cannot set quota on %s: %w", path, ErrNoNode)
+	}
+
+	// create the nodes mirroring the path under the quota root
+	node := quotaPath
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		node += "/" + name
+		_, err = client.Create(ctx, node, nil, CreateModePersistent, OpenACLUnsafe)
+		if err != nil && !errors.Is(err, ErrNodeExists) {
+			return err
+		}
+	}
+
+	limitsPath, statsPath := quotaNodePaths(path)
+	_, err = client.Create(ctx, limitsPath, []byte(limits.String()), CreateModePersistent, OpenACLUnsafe)
+	if errors.Is(err, ErrNodeExists) {
+		_, err = client.SetData(ctx, limitsPath, []byte(limits.String()), AnyVersion)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	// the server computes the current usage of the subtree once the stats node is created
+	stats := Quota{Count: 0, Bytes: 0}
+	_, err = client.Create(ctx, statsPath, []byte(stats.String()), CreateModePersistent, OpenACLUnsafe)
+	if err != nil && !errors.Is(err, ErrNodeExists) {
+		return err
+	}
+
+	return nil
+}
+
+// ListQuota returns the quota limits of the subtree at the given path, along with its current usage.
+// This is equivalent to the listquota command of the Zookeeper CLI.
+func (client *Client) ListQuota(ctx context.Context, path string) (*Quota, *Quota, error) {
+	if err := client.validateQuotaPath(path); err != nil {
+		return nil, nil, err
+	}
+
+	limitsPath, statsPath := quotaNodePaths(path)
+	data, err := client.GetData(ctx, limitsPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	limits, err := parseQuota(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err = client.GetData(ctx, statsPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	stats, err := parseQuota(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return limits, stats, nil
+}
+
+// DeleteQuota removes the quota of the subtree at the given path.
+// This is equivalent to the delquota command of the Zookeeper CLI.
+func (client *Client) DeleteQuota(ctx context.Context, path string) error {
+	if err := client.validateQuotaPath(path); err != nil {
+		return err
+	}
+
+	limitsPath, statsPath := quotaNodePaths(path)
+	if err := client.Delete(ctx, limitsPath, AnyVersion); err != nil {
+		return err
+	}
+	if err := client.Delete(ctx, statsPath, AnyVersion); err != nil && !errors.Is(err, ErrNoNode) {
+		return err
+	}
+
+	// the quota node itself is kept if it still holds the quotas of a nested subtree
+	err := client.Delete(ctx, quotaPath+path, AnyVersion)
+	if err != nil && !errors.Is(err, ErrNotEmpty) {
+		return err
+	}
+
+	return nil
+}
+
+func (client *Client) validateQuotaPath(path string) error {
+	if chroot, _ := normalizeChroot(client.chrootPath()); chroot != "" {
+		return invalidArgsError("cannot manage quotas through a client chrooted to %s", chroot)
+	}
+	if !strings.HasPrefix(path, "/") || path == "/" || strings.HasSuffix(path, "/") {
+		return invalidArgsError("invalid quota path %q", path)
+	}
+	if path == "/zookeeper" || strings.HasPrefix(path, "/zookeeper/") {
+		return invalidArgsError("cannot manage quotas in the /zookeeper namespace")
+	}
+
+	return nil
+}
+
+func quotaNodePaths(path string) (string, string) {
+	return quotaPath + path + "/" + quotaLimitsNode, quotaPath + path + "/" + quotaStatsNode
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package zk
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Read-write servers are probed with an exponential backoff, similarly to the Java client.
+const (
+	minProbeInterval = 100 * time.Millisecond
+	maxProbeInterval = 60 * time.Second
+)
+
+// probeReadWrite looks for a read-write server while the client is connected to a read-only server.
+// Once one is found, the read-only connection is closed so that the client reconnects to that server on its next call.
+func (client *Client) probeReadWrite(conn *Conn, hosts []string) {
+	interval := minProbeInterval
+	for {
+		for _, host := range hosts {
+			if conn.sessionCtx.Err() != nil {
+				return
+			}
+			if host == conn.server || !client.isReadWrite(conn.sessionCtx, host, conn.sessionTimeout) {
+				continue
+			}
+
+			client.probeLock.Lock()
+			client.readWriteHost = host
+			client.probeLock.Unlock()
+
+			conn.Close()
+			return
+		}
+
+		select {
+		case <-conn.sessionCtx.Done():
+			return
+		case <-time.After(interval):
+		}
+		if interval *= 2; interval > maxProbeInterval {
+			interval = maxProbeInterval
+		}
+	}
+}
+
+// isReadWrite returns whether the server at the given address accepts write requests,
+// using the "isro" four letter word.
+func (client *Client) isReadWrite(ctx context.Context, address string, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := client.Dialer(ctx, client.Network, address)
+	if err != nil {
+		return false
+	}
+	if client.TLSConfig != nil {
+		tlsConn, err := dialTLS(ctx, conn, address, client.TLSConfig)
+		if err != nil {
+			conn.Close()
+			return false
+		}
+		conn = tlsConn
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	if err = conn.SetDeadline(deadline); err != nil {
+		return false
+	}
+	if _, err = conn.Write([]byte("isro")); err != nil {
+		return false
+	}
+
+	response := make([]byte, 2)
+	if _, err = io.ReadFull(conn, response); err != nil {
+		return false
+	}
+
+	return string(response) == "rw"
+}
+
+// takeReadWriteHost returns the read-write server found while probing, if any.
+func (client *Client) takeReadWriteHost() string {
+	client.probeLock.Lock()
+	defer client.probeLock.Unlock()
+
+	host := client.readWriteHost
+	client.readWriteHost = ""
+
+	return host
+}
@@ -0,0 +1,239 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package zk
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/facebookincubator/zk/internal/proto"
+)
+
+// The Zookeeper Java client authenticates using DIGEST-MD5 with a fixed service and server name,
+// which the server expects to be part of the digest URI.
+const (
+	saslService    = "zookeeper"
+	saslServerName = "zk-sasl-md5"
+	saslNonceCount = "00000001"
+)
+
+// SASLConfig configures SASL authentication, which is performed right after a session is established.
+// The DIGEST-MD5 mechanism is used, which matches the credentials configured in the server's
+// JAAS DigestLoginModule section.
+type SASLConfig struct {
+	Username string
+	Password string
+}
+
+// authenticateSASL performs the DIGEST-MD5 handshake described in RFC 2831.
+// It is called before the read loop is started, so packets are exchanged directly on the connection.
+func (c *Conn) authenticateSASL(config *SASLConfig) error {
+	// DIGEST-MD5 has no initial response, so an empty token is sent to request the server's challenge
+	challenge, err := c.saslExchange([]byte{})
+	if err != nil {
+		return err
+	}
+
+	digest := &digestMD5{
+		username:  config.Username,
+		password:  config.Password,
+		digestURI: saslService + "/" + saslServerName,
+	}
+	response, err := digest.respond(challenge)
+	if err != nil {
+		return fmt.Errorf("could not respond to SASL challenge: %w", err)
+	}
+
+	rspAuth, err := c.saslExchange(response)
+	if err != nil {
+		return err
+	}
+	if err = digest.verify(rspAuth); err != nil {
+		return fmt.Errorf("could not verify SASL server response: %w", err)
+	}
+
+	return nil
+}
+
+// saslExchange sends a SASL token to the server and returns the token the server responded with.
+func (c *Conn) saslExchange(token []byte) ([]byte, error) {
+	header := &proto.RequestHeader{
+		Xid:  c.nextXid(),
+		Type: opSASL,
+	}
+	if err := WriteRecords(c.conn, header, &proto.GetSASLRequest{Token: token}); err != nil {
+		return nil, fmt.Errorf("could not write SASL request: %w", err)
+	}
+
+	dec, err := createDecoder(c.conn)
+	if err != nil {
+		return nil, fmt.Errorf("could not read SASL response: %w", err)
+	}
+
+	replyHeader := &proto.ReplyHeader{}
+	if err = dec.ReadRecord(replyHeader); err != nil {
+		return nil, fmt.Errorf("could not decode SASL reply header: %w", err)
+	}
+	if replyHeader.Err != 0 {
+		code := Error(replyHeader.Err)
+		return nil, fmt.Errorf("SASL authentication failed: %w", &code)
+	}
+
+	response := &proto.SetSASLResponse{}
+	if err = dec.ReadRecord(response); err != nil {
+		return nil, fmt.Errorf("could not decode SASL response: %w", err)
+	}
+
+	return response.Token, nil
+}
+
+// digestMD5 implements the client side of the DIGEST-MD5 SASL mechanism, using the "auth" quality of protection.
+type digestMD5 struct {
+	username  string
+	password  string
+	digestURI string
+
+	// values negotiated while responding to the challenge, needed to verify the server's response
+	realm  string
+	nonce  string
+	cnonce string
+}
+
+// respond computes the digest-response to the server's digest-challenge.
+func (d *digestMD5) respond(challenge []byte) ([]byte, error) {
+	directives, err := parseDirectives(string(challenge))
+	if err != nil {
+		return nil, err
+	}
+
+	d.nonce = directives["nonce"]
+	if d.nonce == "" {
+		return nil, errors.New("challenge is missing a nonce")
+	}
+	if algorithm := directives["algorithm"]; algorithm != "md5-sess" {
+		return nil, fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+	if qop, ok := directives["qop"]; ok && !containsToken(qop, "auth") {
+		return nil, fmt.Errorf("server does not support the auth quality of protection: %q", qop)
+	}
+	d.realm = directives["realm"]
+
+	if d.cnonce == "" {
+		nonce := make([]byte, 16)
+		if _, err = rand.Read(nonce); err != nil {
+			return nil, fmt.Errorf("could not generate cnonce: %w", err)
+		}
+		d.cnonce = base64.StdEncoding.EncodeToString(nonce)
+	}
+
+	response := []string{
+		"username=" + quote(d.username),
+		"realm=" + quote(d.realm),
+		"nonce=" + quote(d.nonce),
+		"cnonce=" + quote(d.cnonce),
+		"nc=" + saslNonceCount,
+		"qop=auth",
+		"digest-uri=" + quote(d.digestURI),
+		"response=" + d.digest("AUTHENTICATE:"+d.digestURI),
+	}
+	if directives["charset"] == "utf-8" {
+		response = append(response, "charset=utf-8")
+	}
+
+	return []byte(strings.Join(response, ",")), nil
+}
+
+// verify checks the response-auth sent by the server, which proves that the server knows the password as well.
+func (d *digestMD5) verify(rspAuth []byte) error {
+	directives, err := parseDirectives(string(rspAuth))
+	if err != nil {
+		return err
+	}
+	if directives["rspauth"] != d.digest(":"+d.digestURI) {
+		return errors.New("invalid rspauth")
+	}
+
+	return nil
+}
+
+// digest computes the response value defined in RFC 2831 section 2.1.2.1 for the given A2 value.
+func (d *digestMD5) digest(a2 string) string {
+	credentials := md5.Sum([]byte(d.username + ":" + d.realm + ":" + d.password))
+	a1 := string(credentials[:]) + ":" + d.nonce + ":" + d.cnonce
+
+	return md5Hex(md5Hex(a1) + ":" + d.nonce + ":" + saslNonceCount + ":" + d.cnonce + ":auth:" + md5Hex(a2))
+}
+
+func md5Hex(value string) string {
+	sum := md5.Sum([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// parseDirectives parses a comma-separated list of key=value directives, where values may be quoted strings.
+func parseDirectives(s string) (map[string]string, error) {
+	directives := make(map[string]string)
+	for s = strings.TrimLeft(s, " ,"); s != ""; s = strings.TrimLeft(s, " ,") {
+		idx := strings.Index(s, "=")
+		if idx == -1 {
+			return nil, fmt.Errorf("invalid directive %q", s)
+		}
+		key := strings.TrimSpace(s[:idx])
+		s = s[idx+1:]
+
+		var value strings.Builder
+		if strings.HasPrefix(s, `"`) {
+			closed := false
+			for i := 1; i < len(s); i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				} else if s[i] == '"' {
+					s, closed = s[i+1:], true
+					break
+				}
+				value.WriteByte(s[i])
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated value for directive %q", key)
+			}
+		} else {
+			end := strings.Index(s, ",")
+			if end == -1 {
+				end = len(s)
+			}
+			value.WriteString(strings.TrimSpace(s[:end]))
+			s = s[end:]
+		}
+
+		// only the first realm offered by the server is used
+		if _, ok := directives[key]; !ok {
+			directives[key] = value.String()
+		}
+	}
+
+	return directives, nil
+}
+
+func containsToken(list, token string) bool {
+	for _, value := range strings.Split(list, ",") {
+		if strings.TrimSpace(value) == token {
+			return true
+		}
+	}
+
+	return false
+}
+
+func quote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package zk
+
+import "fmt"
+
+// SessionState represents the state of the client's session with the Zookeeper ensemble.
+type SessionState int32
+
+// These constants represent the session states reported through session events.
+const (
+	// SessionStateConnecting is reported before a connection to a server is established.
+	SessionStateConnecting SessionState = iota
+	// SessionStateConnected is reported once the server has accepted the session.
+	SessionStateConnected
+	// SessionStateConnectedReadOnly is reported once a read-only server has accepted the session,
+	// in which case only read requests can be served.
+	SessionStateConnectedReadOnly
+	// SessionStateDisconnected is reported when the connection to the server is lost or closed.
+	// The session may still be alive on the server until its timeout elapses, so it is in doubt until reconnected.
+	SessionStateDisconnected
+	// SessionStateExpired is reported when the server has expired the session. Ephemeral nodes belonging
+	// to the session are gone. Watches set through a Client are registered again on the session which replaces it.
+	SessionStateExpired
+	// SessionStateAuthFailed is reported when the server rejects the session's credentials.
+	SessionStateAuthFailed
+)
+
+var sessionStateNames = map[SessionState]string{
+	SessionStateConnecting:        "connecting",
+	SessionStateConnected:         "connected",
+	SessionStateConnectedReadOnly: "connected-read-only",
+	SessionStateDisconnected:      "disconnected",
+	SessionStateExpired:           "expired",
+	SessionStateAuthFailed:        "auth-failed",
+}
+
+func (s SessionState) String() string {
+	if name, ok := sessionStateNames[s]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("unknown session state: %d", int32(s))
+}
+
+// SessionEvent reports a transition of the session to a new state.
+type SessionEvent struct {
+	State SessionState
+	// Server is the address of the server the event relates to.
+	Server string
+	// SessionID is the ID of the session, which is zero until a session has been established.
+	SessionID int64
+	// Err is the cause of the transition for the disconnected, expired and auth-failed states, if known.
+	Err error
+}
+
+// sessionState is carried over by a Client from one connection to the next,
+// so that the session is resumed and its watches are restored.
+type sessionState struct {
+	id       int64
+	passwd   []byte
+	lastZxid int64
+	watches  *watchManager
+	// readWrite is set once the session has been accepted by a read-write server
+	readWrite bool
+}
+
+// notifySession calls the client's session event handler, if one is set.
+func (client *Client) notifySession(state SessionState, server string, err error) {
+	if client.SessionEventHandler != nil {
+		client.SessionEventHandler(SessionEvent{State: state, Server: server, Err: err})
+	}
+}
+
+// notifySession calls the session event handler of the client which dialed this connection, if one is set.
+func (c *Conn) notifySession(state SessionState, err error) {
+	if c.sessionEventHandler != nil {
+		c.sessionEventHandler(SessionEvent{State: state, Server: c.server, SessionID: c.sessionID, Err: err})
+	}
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package zk
+
+import (
+	"time"
+
+	"github.com/facebookincubator/zk/internal/data"
+)
+
+// The ephemeral owner field is also used by the server to mark container and TTL nodes.
+// ref: https://github.com/apache/zookeeper/blob/master/zookeeper-server/src/main/java/org/apache/zookeeper/server/EphemeralType.java
+const (
+	containerEphemeralOwner = -1 << 63
+	extendedEphemeralMask   = -1 << 56
+)
+
+// Zxid is a Zookeeper transaction ID. Every change to the Zookeeper state is ordered by a unique zxid.
+type Zxid int64
+
+// Epoch returns the high 32 bits of the zxid, which identify the leader that proposed the change.
+// The epoch is incremented on every leader election.
+func (z Zxid) Epoch() int32 {
+	return int32(z >> 32)
+}
+
+// Counter returns the low 32 bits of the zxid, which order the changes proposed within an epoch.
+// The counter is unsigned, as a new epoch is only forced once it reaches 0xFFFFFFFF.
+func (z Zxid) Counter() uint32 {
+	return uint32(z)
+}
+
+// Stat contains the metadata of a znode as returned by the Zookeeper server.
+type Stat struct {
+	Czxid          Zxid      // zxid of the change that created the znode
+	Mzxid          Zxid      // zxid of the change that last modified the znode
+	Pzxid          Zxid      // zxid of the change that last modified the znode's children
+	Ctime          time.Time // time when the znode was created
+	Mtime          time.Time // time when the znode was last modified
+	Version        int32     // number of changes to the data of the znode
+	Cversion       int32     // number of changes to the children of the znode
+	Aversion       int32     // number of changes to the ACL of the znode
+	EphemeralOwner int64     // raw ephemeral owner field, use IsEphemeral and Owner to interpret it
+	DataLength     int32     // length of the data field of the znode
+	NumChildren    int32     // number of children of the znode
+}
+
+// IsEphemeral returns true if the znode is an ephemeral node owned by a session.
+// Container and TTL nodes, which the server marks using the same field, are not considered ephemeral.
+func (s *Stat) IsEphemeral() bool {
+	return s.EphemeralOwner != 0 &&
+		s.EphemeralOwner != containerEphemeralOwner &&
+		s.EphemeralOwner&extendedEphemeralMask != extendedEphemeralMask
+}
+
+// Owner returns the ID of the session which owns the znode, or 0 if the znode is not ephemeral.
+func (s *Stat) Owner() int64 {
+	if !s.IsEphemeral() {
+		return 0
+	}
+
+	return s.EphemeralOwner
+}
+
+// statFromData converts the Stat received on the wire, which uses millisecond timestamps.
+func statFromData(s *data.Stat) *Stat {
+	return &Stat{
+		Czxid:          Zxid(s.Czxid),
+		Mzxid:          Zxid(s.Mzxid),
+		Pzxid:          Zxid(s.Pzxid),
+		Ctime:          time.Unix(0, s.Ctime*int64(time.Millisecond)),
+		Mtime:          time.Unix(0, s.Mtime*int64(time.Millisecond)),
+		Version:        s.Version,
+		Cversion:       s.Cversion,
+		Aversion:       s.Aversion,
+		EphemeralOwner: s.EphemeralOwner,
+		DataLength:     s.DataLength,
+		NumChildren:    s.NumChildren,
+	}
+}
@@ -9,10 +9,16 @@
 package testutils
 
 import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"sync"
+	"sync/atomic"
 
 	"github.com/facebookincubator/zk"
 	"github.com/facebookincubator/zk/internal/proto"
@@ -30,8 +36,18 @@ type HandlerFunc func(reader jute.RecordReader) (zk.Error, jute.RecordWriter)
 
 // TestServer is a mock Zookeeper server which enables local testing without the need for a Zookeeper instance.
 type TestServer struct {
+	// zxid is incremented for every request handled, accessed atomically
+	zxid int64
+	// readOnly is non-zero if the server only accepts read requests, accessed atomically
+	readOnly int32
+
 	listener        net.Listener
 	ResponseHandler HandlerFunc
+
+	// sessions maps the IDs of live sessions to their passwords
+	sessionsLock  sync.Mutex
+	sessions      map[int64][]byte
+	lastSessionID int64
 }
 
 // NewDefaultServer creates and starts a new TestServer instance with a default local listener and handler.
@@ -47,10 +63,26 @@ func NewServer(handler HandlerFunc) (*TestServer, error) {
 	if err != nil {
 		return nil, err
 	}
-	server := &TestServer{listener: l, ResponseHandler: handler}
+
+	return startServer(l, handler), nil
+}
+
+// NewTLSServer creates and starts a new TestServer instance which accepts TLS connections using the given config.
+// Started servers should be closed by calling Close.
+func NewTLSServer(handler HandlerFunc, config *tls.Config) (*TestServer, error) {
+	l, err := newLocalListener()
+	if err != nil {
+		return nil, err
+	}
+
+	return startServer(tls.NewListener(l, config), handler), nil
+}
+
+func startServer(l net.Listener, handler HandlerFunc) *TestServer {
+	server := &TestServer{listener: l, ResponseHandler: handler, sessions: make(map[int64][]byte)}
 	go server.accept()
 
-	return server, nil
+	return server
 }
 
 // Addr returns the address on which this test server is listening on.
@@ -63,6 +95,49 @@ func (s *TestServer) Close() error {
 	return s.listener.Close()
 }
 
+// ExpireSessions expires all sessions established with the server, so that clients cannot resume them.
+func (s *TestServer) ExpireSessions() {
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
+
+	s.sessions = make(map[int64][]byte)
+}
+
+// SetReadOnly switches the server in or out of read-only mode, as if it were partitioned from the ensemble's quorum.
+// Read-only servers only accept clients which allow read-only connections, and reject write requests with zk.ErrReadOnly.
+func (s *TestServer) SetReadOnly(readOnly bool) {
+	var value int32
+	if readOnly {
+		value = 1
+	}
+	atomic.StoreInt32(&s.readOnly, value)
+}
+
+func (s *TestServer) isReadOnly() bool {
+	return atomic.LoadInt32(&s.readOnly) != 0
+}
+
+// connect establishes a new session, or resumes the requested one if its password matches.
+// The returned response has a timeout of zero if the session has expired, as with a Zookeeper server.
+func (s *TestServer) connect(request *proto.ConnectRequest) *proto.ConnectResponse {
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
+
+	if request.SessionId != 0 {
+		if passwd, ok := s.sessions[request.SessionId]; !ok || !bytes.Equal(passwd, request.Passwd) {
+			return &proto.ConnectResponse{Passwd: make([]byte, len(request.Passwd))}
+		}
+
+		return &proto.ConnectResponse{TimeOut: request.TimeOut, SessionId: request.SessionId, Passwd: request.Passwd}
+	}
+
+	s.lastSessionID++
+	passwd := []byte(fmt.Sprintf("passwd-%d", s.lastSessionID))
+	s.sessions[s.lastSessionID] = passwd
+
+	return &proto.ConnectResponse{TimeOut: request.TimeOut, SessionId: s.lastSessionID, Passwd: passwd}
+}
+
 func newLocalListener() (net.Listener, error) {
 	listener, err := net.Listen("tcp", defaultListenAddress)
 	if err != nil {
@@ -91,13 +166,36 @@ func (s *TestServer) accept() {
 func (s *TestServer) handleConn(conn net.Conn) error {
 	defer conn.Close()
 
-	if err := jute.NewBinaryDecoder(conn).ReadRecord(&proto.ConnectRequest{}); err != nil {
+	// the first four bytes are either the "isro" four letter word or the length of the ConnectRequest
+	prefix := make([]byte, 4)
+	if _, err := io.ReadFull(conn, prefix); err != nil {
+		return fmt.Errorf("error reading ConnectRequest: %w", err)
+	}
+	if string(prefix) == "isro" {
+		return s.writeReadOnlyStatus(conn)
+	}
+
+	request := &proto.ConnectRequest{}
+	allowReadOnly, err := readConnectRequest(int32(binary.BigEndian.Uint32(prefix)), conn, request)
+	if err != nil {
 		return fmt.Errorf("error reading ConnectRequest: %w", err)
 	}
 
-	if err := zk.WriteRecords(conn, &proto.ConnectResponse{}); err != nil {
+	readOnly := s.isReadOnly()
+	if readOnly && !allowReadOnly {
+		return nil // read-only servers close connections from clients which do not allow them
+	}
+	if request.LastZxidSeen > atomic.LoadInt64(&s.zxid) {
+		return nil // servers close connections from clients which have seen a later zxid than theirs
+	}
+
+	response := s.connect(request)
+	if err = zk.WriteRecords(conn, response, readOnlyFlag(readOnly)); err != nil {
 		return fmt.Errorf("error sending ConnectResponse: %w", err)
 	}
+	if response.TimeOut == 0 {
+		return nil // the session has expired, so the connection is closed
+	}
 
 	for {
 		header, req, err := zk.ReadRecord(conn)
@@ -105,8 +203,15 @@ func (s *TestServer) handleConn(conn net.Conn) error {
 			return fmt.Errorf("error reading request: %w", err)
 		}
 
-		errCode, response := s.ResponseHandler(req)
-		send := []jute.RecordWriter{&proto.ReplyHeader{Xid: header.Xid, Err: int32(errCode)}}
+		var errCode zk.Error
+		var response jute.RecordWriter
+		if readOnly && isWriteRequest(req) {
+			errCode = zk.ErrReadOnly
+		} else {
+			errCode, response = s.ResponseHandler(req)
+		}
+		reply := &proto.ReplyHeader{Xid: header.Xid, Zxid: atomic.AddInt64(&s.zxid, 1), Err: int32(errCode)}
+		send := []jute.RecordWriter{reply}
 		if response == nil && errCode == 0 {
 			return errors.New("handler returned nil response")
 		}
@@ -120,14 +225,114 @@ func (s *TestServer) handleConn(conn net.Conn) error {
 	}
 }
 
+// writeReadOnlyStatus responds to the "isro" four letter word, which clients use to find read-write servers.
+func (s *TestServer) writeReadOnlyStatus(w io.Writer) error {
+	status := "rw"
+	if s.isReadOnly() {
+		status = "ro"
+	}
+	if _, err := io.WriteString(w, status); err != nil {
+		return fmt.Errorf("error writing read-only status: %w", err)
+	}
+
+	return nil
+}
+
+// readConnectRequest reads a ConnectRequest of the given length, followed by the flag which tells
+// whether the client allows read-only connections. ConnectRequests have no request header,
+// so they cannot be read through zk.ReadRecord.
+func readConnectRequest(length int32, r io.Reader, request *proto.ConnectRequest) (bool, error) {
+	if length < 0 {
+		return false, fmt.Errorf("invalid length %d", length)
+	}
+
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return false, err
+	}
+
+	dec := jute.NewBinaryDecoder(bytes.NewReader(buf))
+	if err := dec.ReadRecord(request); err != nil {
+		return false, err
+	}
+	// older clients do not send the flag
+	allowReadOnly, err := dec.ReadBoolean()
+	if err != nil {
+		return false, nil
+	}
+
+	return allowReadOnly, nil
+}
+
+// readOnlyFlag follows the ConnectResponse, telling the client whether the server is read-only.
+type readOnlyFlag bool
+
+// Write implements jute.RecordWriter.
+func (f readOnlyFlag) Write(enc jute.Encoder) error {
+	if err := enc.WriteStart(); err != nil {
+		return err
+	}
+	if err := enc.WriteBoolean(bool(f)); err != nil {
+		return err
+	}
+
+	return enc.WriteEnd()
+}
+
+// isWriteRequest returns whether the request modifies the data tree, in which case read-only servers reject it.
+func isWriteRequest(request jute.RecordReader) bool {
+	switch request.(type) {
+	case *proto.CreateRequest, *proto.CreateTTLRequest, *proto.DeleteRequest, *proto.SetDataRequest,
+		*proto.SetACLRequest:
+		return true
+	}
+
+	return false
+}
+
+// EmptyResponse can be returned by handlers for requests which the server acknowledges
+// with only a ReplyHeader, such as Delete.
+type EmptyResponse struct{}
+
+// Write implements jute.RecordWriter without encoding any data.
+func (r *EmptyResponse) Write(enc jute.Encoder) error {
+	return nil
+}
+
 // DefaultHandler returns a default response based on the request received, with no error code.
 func DefaultHandler(request jute.RecordReader) (zk.Error, jute.RecordWriter) {
 	var resp jute.RecordWriter
-	switch request.(type) {
+	switch r := request.(type) {
+	case *proto.AuthPacket:
+		resp = &EmptyResponse{}
+	case *proto.CreateRequest:
+		resp = &proto.CreateResponse{Path: r.Path}
+	case *proto.CreateTTLRequest:
+		resp = &proto.Create2Response{Path: r.Path}
+	case *proto.DeleteRequest:
+		resp = &EmptyResponse{}
+	case *proto.ExistsRequest:
+		resp = &proto.ExistsResponse{}
 	case *proto.GetDataRequest:
 		resp = &proto.GetDataResponse{Data: []byte("test")}
+	case *proto.SetDataRequest:
+		resp = &proto.SetDataResponse{}
+	case *proto.GetEphemeralsRequest:
+		resp = &proto.GetEphemeralsResponse{Ephemerals: []string{r.PrefixPath + "test"}}
+	case *proto.GetAllChildrenNumberRequest:
+		resp = &proto.GetAllChildrenNumberResponse{TotalNumber: 1}
+	case *proto.SyncRequest:
+		resp = &proto.SyncResponse{Path: r.Path}
+	case *proto.GetACLRequest:
+		resp = &proto.GetACLResponse{}
+	case *proto.SetACLRequest:
+		resp = &proto.SetACLResponse{}
 	case *proto.GetChildrenRequest:
 		resp = &proto.GetChildrenResponse{Children: []string{"test"}}
+	case *proto.GetChildren2Request:
+		resp = &proto.GetChildren2Response{Children: []string{"test"}}
+	case *proto.AddWatchRequest, *proto.SetWatches, *proto.SetWatches2, *proto.CheckWatchesRequest, *proto.RemoveWatchesRequest:
+		resp = &EmptyResponse{}
 	}
 
 	return 0, resp
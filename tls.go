@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package zk
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// dialTLS performs a TLS handshake over an established connection to the given address.
+// If the config does not specify a ServerName, the host of the address is used, so that the certificate
+// of every ensemble member is verified against the host it was dialed through.
+func dialTLS(ctx context.Context, conn net.Conn, address string, config *tls.Config) (net.Conn, error) {
+	config = config.Clone()
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, fmt.Errorf("could not determine TLS server name: %w", err)
+		}
+		config.ServerName = host
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, err
+		}
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+
+	return tlsConn, nil
+}
+
+// CertificateReloader provides a client certificate which is reloaded from disk whenever its files are modified.
+// It can be used as the GetClientCertificate function of a Client's TLS config, so that rotated certificates
+// are presented when connecting to the ensemble without having to recreate the Client.
+// Established connections are not affected by a rotation, since certificates are only exchanged during the handshake.
+type CertificateReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewCertificateReloader loads the certificate and key pair from the given PEM-encoded files.
+func NewCertificateReloader(certFile, keyFile string) (*CertificateReloader, error) {
+	r := &CertificateReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.GetClientCertificate(nil); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// GetClientCertificate returns the current certificate, reloading it first if its files were modified since the last load.
+// If the files cannot be loaded, for example because only one of them has been rotated so far,
+// the previously loaded certificate is returned.
+func (r *CertificateReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTime, err := r.lastModified()
+	if err == nil && !modTime.After(r.modTime) {
+		return r.cert, nil
+	}
+
+	if err == nil {
+		var cert tls.Certificate
+		cert, err = tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err == nil {
+			r.cert, r.modTime = &cert, modTime
+			return r.cert, nil
+		}
+	}
+
+	if r.cert != nil {
+		return r.cert, nil
+	}
+
+	return nil, fmt.Errorf("could not load client certificate: %w", err)
+}
+
+func (r *CertificateReloader) lastModified() (time.Time, error) {
+	var modTime time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+
+	return modTime, nil
+}
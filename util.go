@@ -10,6 +10,7 @@ package zk
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
 
@@ -51,6 +52,7 @@ func WriteRecords(w io.Writer, generated ...jute.RecordWriter) error {
 
 // ReadRecord reads the request header and body depending on the opcode.
 // It returns the serialized request header and body, or an error if it occurs.
+// The returned body is nil for requests which consist of only a request header.
 func ReadRecord(r io.Reader) (*proto.RequestHeader, jute.RecordReader, error) {
 	dec, err := createDecoder(r)
 	if err != nil {
@@ -64,10 +66,52 @@ func ReadRecord(r io.Reader) (*proto.RequestHeader, jute.RecordReader, error) {
 
 	var req jute.RecordReader
 	switch header.Type {
+	case opAuth:
+		req = &proto.AuthPacket{}
+	case opCreate, opCreate2, opCreateContainer:
+		req = &proto.CreateRequest{}
+	case opCreateTTL:
+		req = &proto.CreateTTLRequest{}
+	case opDelete:
+		req = &proto.DeleteRequest{}
+	case opExists:
+		req = &proto.ExistsRequest{}
 	case opGetData:
 		req = &proto.GetDataRequest{}
+	case opSetData:
+		req = &proto.SetDataRequest{}
+	case opSASL:
+		req = &proto.GetSASLRequest{}
+	case opGetEphemerals:
+		req = &proto.GetEphemeralsRequest{}
+	case opGetAllChildrenNumber:
+		req = &proto.GetAllChildrenNumberRequest{}
+	case opSync:
+		req = &proto.SyncRequest{}
+	case opMulti:
+		req = &multiRequest{}
+	case opReconfig:
+		req = &proto.ReconfigRequest{}
+	case opGetACL:
+		req = &proto.GetACLRequest{}
+	case opSetACL:
+		req = &proto.SetACLRequest{}
 	case opGetChildren:
 		req = &proto.GetChildrenRequest{}
+	case opGetChildren2:
+		req = &proto.GetChildren2Request{}
+	case opAddWatch:
+		req = &proto.AddWatchRequest{}
+	case opSetWatches:
+		req = &proto.SetWatches{}
+	case opSetWatches2:
+		req = &proto.SetWatches2{}
+	case opCheckWatches:
+		req = &proto.CheckWatchesRequest{}
+	case opRemoveWatches:
+		req = &proto.RemoveWatchesRequest{}
+	case opWhoAmI:
+		return header, nil, nil // whoAmI requests have no body
 	default:
 		return nil, nil, fmt.Errorf("unrecognized header type: %d", header.Type)
 	}
@@ -82,14 +126,21 @@ func ReadRecord(r io.Reader) (*proto.RequestHeader, jute.RecordReader, error) {
 // createDecoder reads a packet from io.Reader by reading N bytes from the packet header first,
 // and then reading the remaining N bytes as per the Zookeeper protocol.
 // It returns a jute.Decoder which can then be used to serialize the bytes into a valid struct.
+// The packet is read without buffering, since a buffered reader could consume the beginning of the next packet,
+// such as a watch notification sent right after a reply.
 func createDecoder(r io.Reader) (jute.Decoder, error) {
-	dec := jute.NewBinaryDecoder(r)
-	readBytes, err := dec.ReadBuffer()
-	if err != nil {
+	var length int32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
 		return nil, fmt.Errorf("error reading packet: %w", err)
 	}
+	if length < 0 {
+		return nil, fmt.Errorf("error reading packet: invalid length %d", length)
+	}
 
-	dec = jute.NewBinaryDecoder(bytes.NewBuffer(readBytes))
+	readBytes := make([]byte, length)
+	if _, err := io.ReadFull(r, readBytes); err != nil {
+		return nil, fmt.Errorf("error reading packet: %w", err)
+	}
 
-	return dec, nil
+	return jute.NewBinaryDecoder(bytes.NewReader(readBytes)), nil
 }
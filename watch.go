@@ -0,0 +1,372 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package zk
+
+import (
+	"fmt"
+	"path"
+	"sync"
+
+	"github.com/facebookincubator/zk/internal/proto"
+)
+
+// maxSetWatchesSize limits the size of the paths sent in a single SetWatches2 request, the same way as the Java client,
+// so that restoring many watches does not exceed the server's maximum packet size.
+const maxSetWatchesSize = 128 * 1024
+
+// EventType represents the type of change a watch notification was triggered by.
+// ref: https://zookeeper.apache.org/doc/current/apidocs/zookeeper-server/org/apache/zookeeper/Watcher.Event.EventType.html
+type EventType int32
+
+// These constants represent the event types sent by the Zookeeper server in watch notifications.
+const (
+	EventNodeCreated         EventType = 1
+	EventNodeDeleted         EventType = 2
+	EventNodeDataChanged     EventType = 3
+	EventNodeChildrenChanged EventType = 4
+	// The below event types are delivered by the client when a watch is removed through RemoveWatches.
+	EventDataWatchRemoved       EventType = 5
+	EventChildWatchRemoved      EventType = 6
+	EventPersistentWatchRemoved EventType = 7
+)
+
+var eventTypeNames = map[EventType]string{
+	EventNodeCreated:         "node-created",
+	EventNodeDeleted:         "node-deleted",
+	EventNodeDataChanged:     "node-data-changed",
+	EventNodeChildrenChanged: "node-children-changed",
+
+	EventDataWatchRemoved:       "data-watch-removed",
+	EventChildWatchRemoved:      "child-watch-removed",
+	EventPersistentWatchRemoved: "persistent-watch-removed",
+}
+
+func (t EventType) String() string {
+	if name, ok := eventTypeNames[t]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("unknown event type: %d", int32(t))
+}
+
+// AddWatchMode determines which changes a watch added through AddWatch is triggered by.
+type AddWatchMode int32
+
+// These constants represent the modes supported by AddWatch. Watches added through AddWatch are not removed
+// once triggered, unlike watches set by GetDataW, ExistsW and GetChildrenW.
+const (
+	// AddWatchModePersistent watches are triggered by changes to the znode's data and children,
+	// as well as its creation and deletion.
+	AddWatchModePersistent AddWatchMode = 0
+	// AddWatchModePersistentRecursive watches are triggered by the creation, deletion and data changes
+	// of the znode and all of its descendants. Children changes are not reported, as they are implied by
+	// the creation and deletion events.
+	AddWatchModePersistentRecursive AddWatchMode = 1
+)
+
+var addWatchModeNames = map[AddWatchMode]string{
+	AddWatchModePersistent:          "persistent",
+	AddWatchModePersistentRecursive: "persistent-recursive",
+}
+
+func (m AddWatchMode) String() string {
+	if name, ok := addWatchModeNames[m]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("unknown add watch mode: %d", int32(m))
+}
+
+// WatcherType selects the watches on a path which are checked or removed by CheckWatches and RemoveWatches.
+type WatcherType int32
+
+// These constants represent the watcher types supported by the Zookeeper server.
+const (
+	// WatcherTypeChildren selects watches set by GetChildrenW.
+	WatcherTypeChildren WatcherType = 1
+	// WatcherTypeData selects watches set by GetDataW and ExistsW.
+	WatcherTypeData WatcherType = 2
+	// WatcherTypeAny selects all watches set on the path.
+	WatcherTypeAny WatcherType = 3
+	// WatcherTypePersistent and WatcherTypePersistentRecursive select watches added through AddWatch.
+	WatcherTypePersistent          WatcherType = 4
+	WatcherTypePersistentRecursive WatcherType = 5
+)
+
+var watcherTypeNames = map[WatcherType]string{
+	WatcherTypeChildren:            "children",
+	WatcherTypeData:                "data",
+	WatcherTypeAny:                 "any",
+	WatcherTypePersistent:          "persistent",
+	WatcherTypePersistentRecursive: "persistent-recursive",
+}
+
+func (t WatcherType) String() string {
+	if name, ok := watcherTypeNames[t]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("unknown watcher type: %d", int32(t))
+}
+
+// kinds returns the kinds of watches selected by the watcher type.
+func (t WatcherType) kinds() []watchKind {
+	switch t {
+	case WatcherTypeChildren:
+		return []watchKind{watchKindChildren}
+	case WatcherTypeData:
+		return []watchKind{watchKindData, watchKindExist}
+	case WatcherTypeAny:
+		return []watchKind{watchKindData, watchKindExist, watchKindChildren, watchKindPersistent, watchKindPersistentRecursive}
+	case WatcherTypePersistent:
+		return []watchKind{watchKindPersistent}
+	case WatcherTypePersistentRecursive:
+		return []watchKind{watchKindPersistentRecursive}
+	}
+
+	return nil
+}
+
+// Event is a watch notification sent by the Zookeeper server when a watched znode changes.
+type Event struct {
+	Type EventType
+	Path string
+}
+
+// watchKind differentiates watches set on a znode's data, which are set by GetData and Exists,
+// from watches set on a znode's list of children and from the persistent watches added through AddWatch.
+// Watches set by Exists on a missing znode are tracked separately, as the server restores them differently.
+type watchKind int
+
+const (
+	watchKindData watchKind = iota
+	watchKindExist
+	watchKindChildren
+	watchKindPersistent
+	watchKindPersistentRecursive
+)
+
+func (k watchKind) isPersistent() bool {
+	return k == watchKindPersistent || k == watchKindPersistentRecursive
+}
+
+// removedEvent returns the type of the event delivered to watches of this kind when they are removed.
+func (k watchKind) removedEvent() EventType {
+	switch k {
+	case watchKindData, watchKindExist:
+		return EventDataWatchRemoved
+	case watchKindChildren:
+		return EventChildWatchRemoved
+	default:
+		return EventPersistentWatchRemoved
+	}
+}
+
+type watchKey struct {
+	path string
+	kind watchKind
+}
+
+// watchRegistration is attached to a pending request which sets a watch.
+// The watch is only registered once the server has acknowledged the request.
+type watchRegistration struct {
+	key watchKey
+	// ch is used by the watch manager to deliver events, which are received by the caller through events
+	ch     chan Event
+	events chan Event
+	// exists is set for Exists requests, which leave a watch on the server even if the znode does not exist
+	exists bool
+}
+
+// watchManager keeps track of the watches set through a connection and delivers notifications to their channels.
+type watchManager struct {
+	mu      sync.Mutex
+	watches map[watchKey][]chan Event
+}
+
+func newWatchManager() *watchManager {
+	return &watchManager{watches: make(map[watchKey][]chan Event)}
+}
+
+func newWatchRegistration(path string, kind watchKind) *watchRegistration {
+	watch := &watchRegistration{key: watchKey{path: path, kind: kind}}
+	if kind.isPersistent() {
+		// persistent watches can receive any number of events, which are queued by forwardEvents
+		// once the watch is registered, so that a slow receiver does not block the read loop
+		watch.ch = make(chan Event)
+		watch.events = make(chan Event)
+	} else {
+		// one-shot watches receive a single event, so a buffer of one ensures delivery never blocks the read loop
+		watch.ch = make(chan Event, 1)
+		watch.events = watch.ch
+	}
+
+	return watch
+}
+
+// forwardEvents queues events received from in until they are received from out.
+// Once in is closed, the remaining events are forwarded and out is closed.
+func forwardEvents(in <-chan Event, out chan<- Event) {
+	defer close(out)
+
+	var queue []Event
+	for in != nil || len(queue) > 0 {
+		var next Event
+		var send chan<- Event
+		if len(queue) > 0 {
+			next, send = queue[0], out
+		}
+
+		select {
+		case event, ok := <-in:
+			if !ok {
+				in = nil
+				continue
+			}
+			queue = append(queue, event)
+		case send <- next:
+			queue = queue[1:]
+		}
+	}
+}
+
+// register adds the watch if the server's reply code indicates that the watch was set.
+func (m *watchManager) register(watch *watchRegistration, code Error) {
+	if code != 0 && !(watch.exists && code == errNoNode) {
+		return
+	}
+	if code == errNoNode {
+		watch.key.kind = watchKindExist
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if watch.key.kind.isPersistent() {
+		go forwardEvents(watch.ch, watch.events)
+	}
+	m.watches[watch.key] = append(m.watches[watch.key], watch.ch)
+}
+
+// trigger delivers the event to all watches it applies to. One-shot watches are removed once triggered.
+func (m *watchManager) trigger(event Event) {
+	var keys []watchKey
+	switch event.Type {
+	case EventNodeCreated, EventNodeDataChanged:
+		keys = []watchKey{{event.Path, watchKindData}, {event.Path, watchKindExist}, {event.Path, watchKindPersistent}}
+	case EventNodeDeleted:
+		keys = []watchKey{
+			{event.Path, watchKindData}, {event.Path, watchKindExist},
+			{event.Path, watchKindChildren}, {event.Path, watchKindPersistent},
+		}
+	case EventNodeChildrenChanged:
+		keys = []watchKey{{event.Path, watchKindChildren}, {event.Path, watchKindPersistent}}
+	}
+	if event.Type != EventNodeChildrenChanged {
+		for p := event.Path; ; p = path.Dir(p) {
+			keys = append(keys, watchKey{p, watchKindPersistentRecursive})
+			if p == "/" || p == "." {
+				break
+			}
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range keys {
+		for _, ch := range m.watches[key] {
+			ch <- event
+			if !key.kind.isPersistent() {
+				close(ch)
+			}
+		}
+		if !key.kind.isPersistent() {
+			delete(m.watches, key)
+		}
+	}
+}
+
+// has returns whether any watches of the given kinds are set on the path.
+func (m *watchManager) has(path string, kinds []watchKind) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, kind := range kinds {
+		if len(m.watches[watchKey{path, kind}]) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// remove removes all watches of the given kinds set on the path, delivering a removal event before closing their channels.
+func (m *watchManager) remove(path string, kinds []watchKind) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, kind := range kinds {
+		key := watchKey{path, kind}
+		for _, ch := range m.watches[key] {
+			ch <- Event{Type: kind.removedEvent(), Path: path}
+			close(ch)
+		}
+		delete(m.watches, key)
+	}
+}
+
+// setWatches returns the requests which restore all watches on a new connection. The server triggers
+// the restored watches for changes made after relativeZxid, so that no change is missed while disconnected.
+// Watches are tracked by their client-side paths, which are mapped to the server's namespace by serverPath.
+func (m *watchManager) setWatches(relativeZxid int64, serverPath func(string) string) []*proto.SetWatches2 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var requests []*proto.SetWatches2
+	var request *proto.SetWatches2
+	size := 0
+	for key := range m.watches {
+		path := serverPath(key.path)
+		if request == nil || size+len(path) > maxSetWatchesSize {
+			request = &proto.SetWatches2{RelativeZxid: relativeZxid}
+			requests = append(requests, request)
+			size = 0
+		}
+		size += len(path)
+
+		switch key.kind {
+		case watchKindData:
+			request.DataWatches = append(request.DataWatches, path)
+		case watchKindExist:
+			request.ExistWatches = append(request.ExistWatches, path)
+		case watchKindChildren:
+			request.ChildWatches = append(request.ChildWatches, path)
+		case watchKindPersistent:
+			request.PersistentWatches = append(request.PersistentWatches, path)
+		case watchKindPersistentRecursive:
+			request.PersistentRecursiveWatches = append(request.PersistentRecursiveWatches, path)
+		}
+	}
+
+	return requests
+}
+
+// closeAll closes the channels of all watches without delivering an event, since they can no longer be triggered.
+func (m *watchManager) closeAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, channels := range m.watches {
+		for _, ch := range channels {
+			close(ch)
+		}
+		delete(m.watches, key)
+	}
+}